@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// deletedUserID replaces the poster of jobs and the payer of payments that
+// outlive a deleted account. See docs/data-retention.md.
+const deletedUserID = "deleted-user"
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"newEmail"`
+	Password string `json:"password"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`    // TOTP code, when 2FA is enabled
+	Confirm  string `json:"confirm"` // must be "DELETE" for accounts without a password
+}
+
+// ChangePassword sets a new password. Accounts that have a password must
+// confirm the current one; wallet and OIDC accounts can set a first one.
+// Every other session is logged out and the caller gets a fresh one.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if len(req.NewPassword) < 6 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Password must be at least 6 characters"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	if user.Password != "" && !checkPassword(req.CurrentPassword, user.Password) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Current password is incorrect"})
+		return
+	}
+
+	hashed, err := hashPassword(req.NewPassword)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to hash password"})
+		return
+	}
+
+	if _, err := UsersCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"password": hashed}}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update password"})
+		return
+	}
+
+	if err := revokeAllSessions(ctx, userID); err != nil {
+		log.Println("change password: revoke sessions:", err)
+	}
+	if err := revokeAllAPIKeys(ctx, userID); err != nil {
+		log.Println("change password: revoke api keys:", err)
+	}
+	recordAudit(ctx, AuditEvent{Event: "password_changed", UserID: userID, IP: clientIP(r)})
+
+	user.SessionVersion++
+	resp, _, err := issueTokens(ctx, user, r.UserAgent())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create token"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ChangeEmail starts an email change. The new address only replaces the old
+// one once the link sent to it is opened (see VerifyEmail).
+func ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	req.NewEmail = strings.TrimSpace(req.NewEmail)
+	if !validEmail(req.NewEmail) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "A valid email is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	if user.Password != "" && !checkPassword(req.Password, user.Password) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Incorrect password"})
+		return
+	}
+
+	if req.NewEmail == user.Email {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "This is already your email"})
+		return
+	}
+
+	taken, err := UsersCol.CountDocuments(ctx, bson.M{"email": req.NewEmail})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+		return
+	}
+	if taken > 0 {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Email already registered"})
+		return
+	}
+
+	if _, err := UsersCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"pendingEmail": req.NewEmail}}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to start email change"})
+		return
+	}
+
+	if err := sendEmailVerification(ctx, user, req.NewEmail); err != nil {
+		log.Println("change email:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to send verification email"})
+		return
+	}
+
+	if user.Email != "" {
+		if err := mailer.Send(ctx, MailMessage{
+			To:      user.Email,
+			Subject: "Your email address is being changed",
+			Body: fmt.Sprintf("Someone asked to change the email of your RizeOS account to %s.\n\n"+
+				"If it wasn't you, reset your password right away.\n", req.NewEmail),
+		}); err != nil {
+			log.Println("change email: notify old address:", err)
+		}
+	}
+	recordAudit(ctx, AuditEvent{Event: "email_change_requested", UserID: userID, IP: clientIP(r)})
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Check your new inbox to confirm the change"})
+}
+
+// DeleteAccount closes the caller's account and applies the retention policy
+// in docs/data-retention.md to everything tied to it.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	if user.Password != "" {
+		if !checkPassword(req.Password, user.Password) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Incorrect password"})
+			return
+		}
+	} else if req.Confirm != "DELETE" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": `Send "confirm": "DELETE" to delete this account`})
+		return
+	}
+
+	if user.TOTPEnabled && !checkSecondFactor(ctx, user, req.Code, normalizeIfRecovery(req.Code)) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid authentication code"})
+		return
+	}
+
+	if err := deleteUserData(ctx, userID); err != nil {
+		log.Println("delete account:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete account"})
+		return
+	}
+
+	if _, err := UsersCol.DeleteOne(ctx, bson.M{"_id": user.ID}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete account"})
+		return
+	}
+	recordAudit(ctx, AuditEvent{Event: "account_deleted", UserID: userID, IP: clientIP(r)})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account deleted"})
+}
+
+// deleteUserData removes or anonymizes everything tied to userID except the
+// user document itself. It is idempotent so a failed deletion can be retried.
+func deleteUserData(ctx context.Context, userID string) error {
+	now := time.Now()
+
+	// Export archives on disk go before their records, which name them.
+	exports, err := findAllFor[DataExport](ctx, ExportsCol, bson.M{"userId": userID})
+	if err != nil {
+		return fmt.Errorf("exports: %w", err)
+	}
+	for _, export := range exports {
+		if err := os.Remove(exportPath(export.ID)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("exports: %w", err)
+		}
+	}
+
+	// Personal data: deleted outright.
+	for _, col := range []*mongo.Collection{ProfilesCol, SessionsCol, APIKeysCol, PasswordResetsCol, EmailVerificationsCol, ExportsCol, SavedJobsCol, SavedSearchesCol} {
+		if _, err := col.DeleteMany(ctx, bson.M{"userId": userID}); err != nil {
+			return fmt.Errorf("%s: %w", col.Name(), err)
+		}
+	}
+
+	// Applications: personal data of the candidate.
+	if _, err := ApplicationsCol.DeleteMany(ctx, bson.M{"candidateId": userID}); err != nil {
+		return fmt.Errorf("applications: %w", err)
+	}
+
+	// Bookmarks: the employer's own, and any of them as a candidate.
+	if _, err := BookmarksCol.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"employerId": userID},
+		bson.M{"candidateId": userID},
+	}}); err != nil {
+		return fmt.Errorf("bookmarks: %w", err)
+	}
+
+	// Job postings: closed and detached from the account.
+	open, err := findAllFor[Job](ctx, JobsCol, bson.M{"postedBy": userID, "status": bson.M{"$ne": StatusClosed}})
+	if err != nil {
+		return fmt.Errorf("jobs: %w", err)
+	}
+	if _, err := JobsCol.UpdateMany(ctx,
+		bson.M{"postedBy": userID, "status": bson.M{"$ne": StatusClosed}},
+		bson.M{
+			"$set": bson.M{"status": StatusClosed, "statusChangedAt": now, "closedAt": now, "updatedAt": now},
+			"$inc": bson.M{"version": 1},
+		},
+	); err != nil {
+		return fmt.Errorf("jobs: %w", err)
+	}
+	if _, err := JobsCol.UpdateMany(ctx, bson.M{"postedBy": userID}, bson.M{"$set": bson.M{"postedBy": deletedUserID}}); err != nil {
+		return fmt.Errorf("jobs: %w", err)
+	}
+	for _, job := range open {
+		unindexJob(ctx, job.ID)
+	}
+
+	// Payments: kept for accounting, but no longer linked to the person.
+	if _, err := PaymentsCol.UpdateMany(ctx,
+		bson.M{"userId": userID},
+		bson.M{"$set": bson.M{"userId": deletedUserID, "accountDeletedAt": now}},
+	); err != nil {
+		return fmt.Errorf("payments: %w", err)
+	}
+	return nil
+}
+
+func RegisterAccountRoutes(r *mux.Router) {
+	r.HandleFunc("/api/me/password", JWTMiddleware(ChangePassword)).Methods("PUT")
+	r.HandleFunc("/api/me/email", JWTMiddleware(ChangeEmail)).Methods("POST")
+	r.HandleFunc("/api/me", JWTMiddleware(DeleteAccount)).Methods("DELETE")
+}
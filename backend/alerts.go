@@ -0,0 +1,574 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Alert frequencies of a saved search.
+const (
+	FrequencyInstant = "instant"
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+)
+
+const (
+	maxSavedSearches = 20
+	maxSearchName    = 100
+	// maxAlertJobs bounds how many jobs one alert lists; the rest are
+	// counted.
+	maxAlertJobs = 20
+	// keptUnsubscribeTokens is how many recent alerts' unsubscribe links
+	// keep working.
+	keptUnsubscribeTokens = 10
+	// alertRetryDelay is how soon a saved search whose alert failed is run
+	// again.
+	alertRetryDelay = 15 * time.Minute
+)
+
+// SavedSearch is a GET /api/jobs query a user wants to be alerted about.
+// Query is the query string as saved; Filter is its parsed form, which the
+// scheduler runs against jobs published since LastRunAt.
+type SavedSearch struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    string             `bson:"userId" json:"userId"`
+	Name      string             `bson:"name" json:"name"`
+	Query     string             `bson:"query" json:"query"`
+	Filter    JobFilter          `bson:"filter" json:"filter"`
+	Frequency string             `bson:"frequency" json:"frequency"`
+	LastRunAt time.Time          `bson:"lastRunAt" json:"lastRunAt"`
+	NextRunAt time.Time          `bson:"nextRunAt" json:"nextRunAt"`
+	// UnsubscribedAt is set when alerts were turned off from an email link.
+	UnsubscribedAt *time.Time `bson:"unsubscribedAt,omitempty" json:"unsubscribedAt,omitempty"`
+	// UnsubscribeTokens hashes the unsubscribe links of recent alerts.
+	UnsubscribeTokens []string  `bson:"unsubscribeTokens,omitempty" json:"-"`
+	CreatedAt         time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt         time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+func alertPeriod(frequency string) (time.Duration, bool) {
+	switch frequency {
+	case FrequencyInstant:
+		return 0, true
+	case FrequencyDaily:
+		return 24 * time.Hour, true
+	case FrequencyWeekly:
+		return 7 * 24 * time.Hour, true
+	}
+	return 0, false
+}
+
+// JobAlert is one delivery of a saved search: the newest matching jobs and
+// how many matched in all.
+type JobAlert struct {
+	User           User
+	Search         SavedSearch
+	Jobs           []Job
+	Total          int64
+	UnsubscribeURL string
+}
+
+// AlertNotifier delivers job alerts.
+type AlertNotifier interface {
+	Notify(ctx context.Context, alert JobAlert) error
+}
+
+var alertNotifier AlertNotifier
+
+// InitAlerts picks the notifier from ALERT_NOTIFIER: "email" (the default,
+// through the mail sink chosen by MAIL_SINK) or "log".
+func InitAlerts() {
+	if os.Getenv("ALERT_NOTIFIER") == "log" {
+		alertNotifier = LogAlertNotifier{}
+		return
+	}
+	alertNotifier = EmailAlertNotifier{}
+}
+
+// EmailAlertNotifier mails alerts as a plain-text digest.
+type EmailAlertNotifier struct{}
+
+func (EmailAlertNotifier) Notify(ctx context.Context, a JobAlert) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "New jobs matching your saved search %q:\n\n", a.Search.Name)
+	for _, job := range a.Jobs {
+		fmt.Fprintf(&b, "- %s\n  %s/jobs/%s\n", job.Title, appURL(), job.ID.Hex())
+	}
+	if more := a.Total - int64(len(a.Jobs)); more > 0 {
+		fmt.Fprintf(&b, "\nand %d more: %s/jobs?%s\n", more, appURL(), a.Search.Query)
+	}
+	fmt.Fprintf(&b, "\nYou get these %s. To stop them, open:\n%s\n", frequencyPhrase(a.Search.Frequency), a.UnsubscribeURL)
+
+	subject := fmt.Sprintf("%d new jobs for %q", a.Total, a.Search.Name)
+	if a.Total == 1 {
+		subject = fmt.Sprintf("A new job for %q", a.Search.Name)
+	}
+	return mailer.Send(ctx, MailMessage{
+		To:      a.User.Email,
+		Subject: subject,
+		Body:    b.String(),
+		// One-click unsubscribe from the mail client (RFC 8058).
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + a.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
+
+func frequencyPhrase(frequency string) string {
+	switch frequency {
+	case FrequencyDaily:
+		return "once a day"
+	case FrequencyWeekly:
+		return "once a week"
+	}
+	return "as jobs are posted"
+}
+
+// LogAlertNotifier writes alerts to the server log instead of sending them.
+type LogAlertNotifier struct{}
+
+func (LogAlertNotifier) Notify(ctx context.Context, a JobAlert) error {
+	log.Printf("job alert user=%s search=%s jobs=%d unsubscribe=%s", a.User.ID.Hex(), a.Search.ID.Hex(), a.Total, a.UnsubscribeURL)
+	return nil
+}
+
+// StartAlertScheduler runs due saved searches every ALERT_INTERVAL (1m by
+// default). Instant searches are due on every run.
+func StartAlertScheduler() {
+	interval := time.Minute
+	if d, err := time.ParseDuration(os.Getenv("ALERT_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			if n, err := runDueAlerts(ctx, time.Now()); err != nil {
+				log.Println("job alerts:", err)
+			} else if n > 0 {
+				log.Printf("Sent %d job alerts", n)
+			}
+			cancel()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func runDueAlerts(ctx context.Context, now time.Time) (int, error) {
+	due, err := findAllFor[SavedSearch](ctx, SavedSearchesCol, bson.M{
+		"nextRunAt":      bson.M{"$lte": now},
+		"unsubscribedAt": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, s := range due {
+		ok, err := runAlert(ctx, s, now)
+		if err != nil {
+			log.Println("job alert", s.ID.Hex()+":", err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// runAlert claims a due search, so only one instance runs it, and sends the
+// jobs published since its last run, if any. It reports whether an alert
+// was sent. lastRunAt only moves once the run went through; a failed run is
+// retried after alertRetryDelay and still covers the same jobs.
+func runAlert(ctx context.Context, s SavedSearch, now time.Time) (bool, error) {
+	period, _ := alertPeriod(s.Frequency)
+	next := now.Add(period)
+	res, err := SavedSearchesCol.UpdateOne(ctx,
+		bson.M{"_id": s.ID, "nextRunAt": s.NextRunAt},
+		bson.M{"$set": bson.M{"nextRunAt": next}},
+	)
+	if err != nil || res.ModifiedCount == 0 {
+		return false, err
+	}
+
+	sent, err := sendAlert(ctx, s, now)
+	if err != nil {
+		retry := now.Add(alertRetryDelay)
+		if retry.After(next) {
+			retry = next
+		}
+		if _, uerr := SavedSearchesCol.UpdateOne(ctx,
+			bson.M{"_id": s.ID, "nextRunAt": next},
+			bson.M{"$set": bson.M{"nextRunAt": retry}},
+		); uerr != nil {
+			log.Println("job alert", s.ID.Hex()+":", uerr)
+		}
+		return false, err
+	}
+	_, err = SavedSearchesCol.UpdateOne(ctx, bson.M{"_id": s.ID}, bson.M{"$set": bson.M{"lastRunAt": now}})
+	return sent, err
+}
+
+// sendAlert notifies the owner of s about the jobs published between its
+// last run and now. It reports whether there was anything to send.
+func sendAlert(ctx context.Context, s SavedSearch, now time.Time) (bool, error) {
+	filter := bson.M{"$and": bson.A{
+		s.Filter.bson(),
+		bson.M{"publishedAt": bson.M{"$gt": s.LastRunAt, "$lte": now}},
+		bson.M{"postedBy": bson.M{"$ne": s.UserID}},
+	}}
+	total, err := JobsCol.CountDocuments(ctx, filter)
+	if err != nil || total == 0 {
+		return false, err
+	}
+	user, err := findUserByID(ctx, s.UserID)
+	if err != nil {
+		return false, err
+	}
+	// Alerts only go to confirmed addresses.
+	if user.Email == "" || !user.Verified {
+		return false, nil
+	}
+	jobs, err := findAllFor[Job](ctx, JobsCol, filter,
+		options.Find().SetSort(bson.D{{Key: "publishedAt", Value: -1}}).SetLimit(maxAlertJobs))
+	if err != nil {
+		return false, err
+	}
+
+	raw, hash, err := generateToken()
+	if err != nil {
+		return false, err
+	}
+	_, err = SavedSearchesCol.UpdateOne(ctx, bson.M{"_id": s.ID}, bson.M{"$push": bson.M{
+		"unsubscribeTokens": bson.M{"$each": bson.A{hash}, "$slice": -keptUnsubscribeTokens},
+	}})
+	if err != nil {
+		return false, err
+	}
+
+	err = alertNotifier.Notify(ctx, JobAlert{
+		User:           user,
+		Search:         s,
+		Jobs:           jobs,
+		Total:          total,
+		UnsubscribeURL: appURL() + "/api/alerts/unsubscribe?token=" + raw,
+	})
+	return err == nil, err
+}
+
+type SavedSearchRequest struct {
+	Name      string `json:"name"`
+	Query     string `json:"query"`
+	Frequency string `json:"frequency"`
+}
+
+// parseSavedSearch validates a saved search. The query uses the GET
+// /api/jobs filter grammar; paging and status parameters are not saved.
+func parseSavedSearch(r *http.Request, req SavedSearchRequest) (SavedSearch, error) {
+	s := SavedSearch{Name: strings.TrimSpace(req.Name), Frequency: req.Frequency}
+	if s.Name == "" || len(s.Name) > maxSearchName {
+		return s, errors.New("name must be between 1 and 100 characters")
+	}
+	if s.Frequency == "" {
+		s.Frequency = FrequencyDaily
+	}
+	if _, ok := alertPeriod(s.Frequency); !ok {
+		return s, errors.New("frequency must be instant, daily or weekly")
+	}
+
+	q, err := url.ParseQuery(strings.TrimPrefix(req.Query, "?"))
+	if err != nil {
+		return s, errors.New("query must be a URL query string such as skills=go&q=remote")
+	}
+	if q.Get("status") != "" {
+		return s, errors.New("saved searches always look for published jobs; remove status")
+	}
+	q.Del("limit")
+	q.Del("cursor")
+	if s.Filter, err = parseJobFilter(r, q); err != nil {
+		return s, err
+	}
+	s.Query = q.Encode()
+	return s, nil
+}
+
+// CreateSavedSearch saves a search for the caller. Alerts cover jobs
+// published from now on.
+func CreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	var req SavedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	search, err := parseSavedSearch(r, req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	n, err := SavedSearchesCol.CountDocuments(ctx, bson.M{"userId": userID})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to save search"})
+		return
+	}
+	if n >= maxSavedSearches {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("You can have at most %d saved searches", maxSavedSearches)})
+		return
+	}
+
+	now := time.Now()
+	period, _ := alertPeriod(search.Frequency)
+	search.UserID = userID
+	search.LastRunAt, search.NextRunAt = now, now.Add(period)
+	search.CreatedAt, search.UpdatedAt = now, now
+	res, err := SavedSearchesCol.InsertOne(ctx, search)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to save search"})
+		return
+	}
+	search.ID = res.InsertedID.(primitive.ObjectID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(search)
+}
+
+// ListSavedSearches returns the caller's saved searches, newest first.
+func ListSavedSearches(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	searches, err := findAllFor[SavedSearch](ctx, SavedSearchesCol, bson.M{"userId": userID}, options.Find().SetSort(pageSort))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch saved searches"})
+		return
+	}
+	json.NewEncoder(w).Encode(searches)
+}
+
+// UpdateSavedSearch replaces the name, query and frequency of a saved
+// search. It also turns alerts back on after an unsubscribe.
+func UpdateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	oid, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Saved search not found"})
+		return
+	}
+	var req SavedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	search, err := parseSavedSearch(r, req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The next run is rescheduled from the last one, so switching from
+	// weekly to daily takes effect right away if a day has passed.
+	var existing SavedSearch
+	if err := SavedSearchesCol.FindOne(ctx, bson.M{"_id": oid, "userId": userID}).Decode(&existing); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Saved search not found"})
+		return
+	}
+	now := time.Now()
+	period, _ := alertPeriod(search.Frequency)
+	set := bson.M{
+		"name":      search.Name,
+		"query":     search.Query,
+		"filter":    search.Filter,
+		"frequency": search.Frequency,
+		"nextRunAt": existing.LastRunAt.Add(period),
+		"updatedAt": now,
+	}
+	// Resubscribing starts from now rather than alerting about everything
+	// posted while alerts were off.
+	if existing.UnsubscribedAt != nil {
+		set["lastRunAt"], set["nextRunAt"] = now, now.Add(period)
+	}
+
+	var updated SavedSearch
+	err = SavedSearchesCol.FindOneAndUpdate(ctx,
+		bson.M{"_id": oid, "userId": userID},
+		bson.M{"$set": set, "$unset": bson.M{"unsubscribedAt": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Saved search not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update saved search"})
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteSavedSearch deletes one of the caller's saved searches.
+func DeleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	oid, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Saved search not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := SavedSearchesCol.DeleteOne(ctx, bson.M{"_id": oid, "userId": userID})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete saved search"})
+		return
+	}
+	if res.DeletedCount == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Saved search not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unsubscribePage is shown to people who open an unsubscribe link. The link
+// itself changes nothing, so that mail scanners prefetching it do not
+// unsubscribe anyone; the button posts back to the same URL.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Job alerts</title></head>
+<body>
+{{if .Confirm}}<p>Stop sending job alerts for your saved search &ldquo;{{.Name}}&rdquo;?</p>
+<form method="post"><button type="submit">Unsubscribe</button></form>
+{{else}}<p>{{.Message}}</p>{{end}}
+</body>
+</html>
+`))
+
+type unsubscribeView struct {
+	Confirm bool
+	Name    string
+	Message string
+}
+
+func renderUnsubscribePage(w http.ResponseWriter, status int, v unsubscribeView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Keep the token out of the Referer of anything the page loads.
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	unsubscribePage.Execute(w, v)
+}
+
+// ConfirmUnsubscribe shows which saved search an unsubscribe link is for and
+// asks the user to confirm.
+func ConfirmUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var search SavedSearch
+	token := r.URL.Query().Get("token")
+	if token == "" || SavedSearchesCol.FindOne(ctx, bson.M{"unsubscribeTokens": hashToken(token)}).Decode(&search) != nil {
+		renderUnsubscribePage(w, http.StatusBadRequest, unsubscribeView{Message: "This unsubscribe link is invalid or has expired."})
+		return
+	}
+	if search.UnsubscribedAt != nil {
+		renderUnsubscribePage(w, http.StatusOK, unsubscribeView{Message: fmt.Sprintf("You no longer get alerts for %q.", search.Name)})
+		return
+	}
+	renderUnsubscribePage(w, http.StatusOK, unsubscribeView{Confirm: true, Name: search.Name})
+}
+
+// UnsubscribeAlerts turns off the alerts of the saved search an email link
+// was sent for. It needs no login; the token is the proof. Mail clients
+// post here directly for one-click unsubscribes (RFC 8058); browsers get a
+// page back, other clients JSON.
+func UnsubscribeAlerts(w http.ResponseWriter, r *http.Request) {
+	html := strings.Contains(r.Header.Get("Accept"), "text/html")
+	fail := func(status int, msg string) {
+		if html {
+			renderUnsubscribePage(w, status, unsubscribeView{Message: msg})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": msg})
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		fail(http.StatusBadRequest, "Missing token")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var search SavedSearch
+	err := SavedSearchesCol.FindOneAndUpdate(ctx,
+		bson.M{"unsubscribeTokens": hashToken(token)},
+		bson.M{"$set": bson.M{"unsubscribedAt": now, "updatedAt": now}},
+	).Decode(&search)
+	if err != nil {
+		fail(http.StatusBadRequest, "This unsubscribe link is invalid or has expired")
+		return
+	}
+
+	msg := fmt.Sprintf("You will no longer get alerts for %q", search.Name)
+	if html {
+		renderUnsubscribePage(w, http.StatusOK, unsubscribeView{Message: msg + "."})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": msg})
+}
+
+func RegisterAlertRoutes(r *mux.Router) {
+	r.HandleFunc("/api/me/searches", ScopedAuth(ScopeSavedRead)(ListSavedSearches)).Methods("GET")
+	r.HandleFunc("/api/me/searches", ScopedAuth(ScopeSavedWrite)(CreateSavedSearch)).Methods("POST")
+	r.HandleFunc("/api/me/searches/{id}", ScopedAuth(ScopeSavedWrite)(UpdateSavedSearch)).Methods("PUT")
+	r.HandleFunc("/api/me/searches/{id}", ScopedAuth(ScopeSavedWrite)(DeleteSavedSearch)).Methods("DELETE")
+	r.HandleFunc("/api/alerts/unsubscribe", ConfirmUnsubscribe).Methods("GET")
+	r.HandleFunc("/api/alerts/unsubscribe", UnsubscribeAlerts).Methods("POST")
+}
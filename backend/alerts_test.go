@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseSavedSearch(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       SavedSearchRequest
+		query     string
+		frequency string
+		ok        bool
+	}{
+		{"defaults to daily", SavedSearchRequest{Name: " Remote Go ", Query: "skills=go&q=remote"}, "q=remote&skills=go", FrequencyDaily, true},
+		{"leading ? and paging dropped", SavedSearchRequest{Name: "Go", Query: "?skills=go&limit=5&cursor=abc", Frequency: FrequencyWeekly}, "skills=go", FrequencyWeekly, true},
+		{"salary with currency", SavedSearchRequest{Name: "Paid", Query: "minSalary=50000&currency=USD", Frequency: FrequencyInstant}, "currency=USD&minSalary=50000", FrequencyInstant, true},
+		{"blank name", SavedSearchRequest{Name: "  ", Query: "skills=go"}, "", "", false},
+		{"long name", SavedSearchRequest{Name: strings.Repeat("x", maxSearchName+1), Query: "skills=go"}, "", "", false},
+		{"unknown frequency", SavedSearchRequest{Name: "Go", Query: "skills=go", Frequency: "hourly"}, "", "", false},
+		{"malformed query", SavedSearchRequest{Name: "Go", Query: "skills=%zz"}, "", "", false},
+		{"status", SavedSearchRequest{Name: "Go", Query: "status=draft"}, "", "", false},
+		{"invalid filter", SavedSearchRequest{Name: "Go", Query: "skillsMatch=most"}, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSavedSearch(httptest.NewRequest(http.MethodPost, "/api/me/searches", nil), tt.req)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error = %v, want ok=%v", err, tt.ok)
+			}
+			if tt.ok && (s.Query != tt.query || s.Frequency != tt.frequency || s.Name != strings.TrimSpace(tt.req.Name)) {
+				t.Fatalf("saved search = %+v, want query %q, frequency %q", s, tt.query, tt.frequency)
+			}
+		})
+	}
+}
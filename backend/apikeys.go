@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	apiKeyPrefix = "rzk_"
+
+	ScopeJobsWrite    = "jobs:write"
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+
+	ScopeApplicationsRead  = "applications:read"
+	ScopeApplicationsWrite = "applications:write"
+
+	ScopeSavedRead  = "saved:read"
+	ScopeSavedWrite = "saved:write"
+
+	maxAPIKeysPerUser = 20
+)
+
+var validScopes = map[string]bool{
+	ScopeJobsWrite:    true,
+	ScopeProfileRead:  true,
+	ScopeProfileWrite: true,
+
+	ScopeApplicationsRead:  true,
+	ScopeApplicationsWrite: true,
+
+	ScopeSavedRead:  true,
+	ScopeSavedWrite: true,
+}
+
+// APIKey is a personal, scoped credential for programmatic access. The key
+// itself is only returned once, at creation; the prefix lets users tell their
+// keys apart.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID     string             `bson:"userId" json:"userId"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	KeyHash    string             `bson:"keyHash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"` // 0 = never
+}
+
+func (k APIKey) hasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyFromRequest returns the API key sent in X-API-Key, or as a bearer
+// token with the rzk_ prefix.
+func apiKeyFromRequest(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer "+apiKeyPrefix) {
+		return auth[7:]
+	}
+	return ""
+}
+
+// authenticateAPIKey resolves an active API key and its owner, and records
+// when the key was last used.
+func authenticateAPIKey(ctx context.Context, raw string) (User, APIKey, error) {
+	var key APIKey
+	err := APIKeysCol.FindOne(ctx, bson.M{
+		"keyHash":   hashToken(raw),
+		"revokedAt": bson.M{"$exists": false},
+	}).Decode(&key)
+	if err != nil {
+		return User{}, key, err
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return User{}, key, mongo.ErrNoDocuments
+	}
+
+	user, err := findUserByID(ctx, key.UserID)
+	if err != nil {
+		return user, key, err
+	}
+
+	// Recording every request would mean a write per call; a minute of
+	// precision is plenty.
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		_, _ = APIKeysCol.UpdateOne(ctx, bson.M{"_id": key.ID}, bson.M{"$set": bson.M{"lastUsedAt": now}})
+	}
+	return user, key, nil
+}
+
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Name is required"})
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "At least one scope is required"})
+		return
+	}
+	for _, s := range req.Scopes {
+		if !validScopes[s] {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Unknown scope: " + s})
+			return
+		}
+	}
+
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > 3650 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "expiresInDays must be between 0 and 3650"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	active, err := APIKeysCol.CountDocuments(ctx, bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+		return
+	}
+	if active >= maxAPIKeysPerUser {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Too many active API keys. Revoke one first."})
+		return
+	}
+
+	secret, _, err := generateToken()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create API key"})
+		return
+	}
+	raw := apiKeyPrefix + secret
+
+	now := time.Now()
+	key := APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    raw[:len(apiKeyPrefix)+6],
+		KeyHash:   hashToken(raw),
+		Scopes:    req.Scopes,
+		CreatedAt: now,
+	}
+	if req.ExpiresInDays > 0 {
+		exp := now.AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &exp
+	}
+
+	res, err := APIKeysCol.InsertOne(ctx, key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create API key"})
+		return
+	}
+	key.ID = res.InsertedID.(primitive.ObjectID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"apiKey": key,
+		"key":    raw, // shown once
+	})
+}
+
+func ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cur, err := APIKeysCol.Find(ctx, bson.M{"userId": userID}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch API keys"})
+		return
+	}
+	defer cur.Close(ctx)
+
+	var keys []APIKey
+	if err := cur.All(ctx, &keys); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to decode API keys"})
+		return
+	}
+
+	if keys == nil {
+		keys = []APIKey{}
+	}
+
+	json.NewEncoder(w).Encode(keys)
+}
+
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	oid, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid API key id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := APIKeysCol.UpdateOne(ctx,
+		bson.M{"_id": oid, "userId": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to revoke API key"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "API key not found"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked"})
+}
+
+// revokeAllAPIKeys revokes every active API key of the user, for when the
+// account's credentials are reset.
+func revokeAllAPIKeys(ctx context.Context, userID string) error {
+	_, err := APIKeysCol.UpdateMany(ctx,
+		bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	return err
+}
+
+// Managing keys requires an interactive session; JWTMiddleware refuses API
+// keys, so a leaked key cannot mint more keys.
+func RegisterAPIKeyRoutes(r *mux.Router) {
+	r.HandleFunc("/api/api-keys", JWTMiddleware(CreateAPIKey)).Methods("POST")
+	r.HandleFunc("/api/api-keys", JWTMiddleware(ListAPIKeys)).Methods("GET")
+	r.HandleFunc("/api/api-keys/{id}", JWTMiddleware(RevokeAPIKey)).Methods("DELETE")
+}
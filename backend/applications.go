@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Application statuses.
+const (
+	ApplicationActive    = "active"
+	ApplicationWithdrawn = "withdrawn"
+)
+
+const (
+	maxCoverLetterLength = 5000
+	maxResumeURLLength   = 2048
+)
+
+// Application is a candidate's application to a job. There is at most one
+// per (job, candidate); withdrawing and applying again reuses it.
+type Application struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	JobID       primitive.ObjectID  `bson:"jobId" json:"jobId"`
+	CandidateID string              `bson:"candidateId" json:"candidateId"`
+	ProfileID   *primitive.ObjectID `bson:"profileId,omitempty" json:"profileId,omitempty"`
+	CoverLetter string              `bson:"coverLetter,omitempty" json:"coverLetter,omitempty"`
+	ResumeURL   string              `bson:"resumeUrl,omitempty" json:"resumeUrl,omitempty"`
+	Status      string              `bson:"status" json:"status"`
+	// Stage is the application's place in the job's pipeline; see
+	// pipeline.go.
+	Stage          string             `bson:"stage,omitempty" json:"stage,omitempty"`
+	StageChangedAt *time.Time         `bson:"stageChangedAt,omitempty" json:"stageChangedAt,omitempty"`
+	Timeline       []ApplicationEvent `bson:"timeline,omitempty" json:"timeline,omitempty"`
+	// Answers to the job's screening questions. KnockedOut flags an
+	// applicant whose answers hit a knockout, listed in Knockouts; only the
+	// employer sees the flag.
+	Answers     []Answer   `bson:"answers,omitempty" json:"answers,omitempty"`
+	KnockedOut  bool       `bson:"knockedOut" json:"knockedOut,omitempty"`
+	Knockouts   []string   `bson:"knockouts,omitempty" json:"knockouts,omitempty"`
+	CreatedAt   time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time  `bson:"updatedAt" json:"updatedAt"`
+	WithdrawnAt *time.Time `bson:"withdrawnAt,omitempty" json:"withdrawnAt,omitempty"`
+}
+
+type ApplyRequest struct {
+	CoverLetter string        `json:"coverLetter"`
+	ResumeURL   string        `json:"resumeUrl"`
+	Answers     []AnswerInput `json:"answers"`
+}
+
+// validResumeURL accepts absolute http(s) links, e.g. to a hosted PDF.
+func validResumeURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" && len(s) <= maxResumeURLLength
+}
+
+// Apply submits the caller's application to a published job. The caller's
+// profile is linked, so it must exist.
+func Apply(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	var req ApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	req.CoverLetter = strings.TrimSpace(req.CoverLetter)
+	req.ResumeURL = strings.TrimSpace(req.ResumeURL)
+	if len(req.CoverLetter) > maxCoverLetterLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cover letter can be at most 5000 characters"})
+		return
+	}
+	if req.ResumeURL != "" && !validResumeURL(req.ResumeURL) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "resumeUrl must be an http(s) link"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+	if !user.Verified {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Please verify your email address before applying",
+			"code":  "email_not_verified",
+		})
+		return
+	}
+
+	job, err := findJob(ctx, mux.Vars(r)["id"])
+	if err != nil || job.Status != StatusPublished {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+		return
+	}
+	if job.PostedBy == userID {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "You cannot apply to your own job"})
+		return
+	}
+
+	answers, knockouts, err := checkAnswers(job.Questions, req.Answers)
+	if problems, ok := err.(AnswerErrors); ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  problems.Error(),
+			"code":   "invalid_answers",
+			"fields": problems,
+		})
+		return
+	}
+
+	var profile Profile
+	if err := ProfilesCol.FindOne(ctx, bson.M{"userId": userID}).Decode(&profile); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Please fill in your profile before applying",
+			"code":  "profile_required",
+		})
+		return
+	}
+
+	now := time.Now()
+	app := Application{
+		JobID:       job.ID,
+		CandidateID: userID,
+		ProfileID:   &profile.ID,
+		CoverLetter: req.CoverLetter,
+		ResumeURL:   req.ResumeURL,
+		Status:      ApplicationActive,
+		Stage:       StageApplied,
+		Timeline:    []ApplicationEvent{{Type: EventApplied, To: StageApplied, At: now}},
+		Answers:     answers,
+		KnockedOut:  len(knockouts) > 0,
+		Knockouts:   knockouts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	// A withdrawn application is reopened rather than duplicated, and starts
+	// the pipeline again. One the employer had already decided on stays
+	// closed and ends up as a duplicate below.
+	var existing Application
+	err = ApplicationsCol.FindOneAndUpdate(ctx,
+		bson.M{"jobId": job.ID, "candidateId": userID, "status": ApplicationWithdrawn, "stage": bson.M{"$nin": decidedStages}},
+		bson.M{
+			"$set": bson.M{
+				"profileId":      app.ProfileID,
+				"coverLetter":    app.CoverLetter,
+				"resumeUrl":      app.ResumeURL,
+				"status":         ApplicationActive,
+				"stage":          StageApplied,
+				"stageChangedAt": now,
+				"answers":        app.Answers,
+				"knockedOut":     app.KnockedOut,
+				"knockouts":      app.Knockouts,
+				"updatedAt":      now,
+			},
+			"$unset": bson.M{"withdrawnAt": ""},
+			"$push":  bson.M{"timeline": ApplicationEvent{Type: EventReopened, To: StageApplied, At: now}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&existing)
+	if err == nil {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(existing.forCandidate())
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to apply"})
+		return
+	}
+
+	res, err := ApplicationsCol.InsertOne(ctx, app)
+	if mongo.IsDuplicateKeyError(err) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "You have already applied to this job",
+			"code":  "already_applied",
+		})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to apply"})
+		return
+	}
+
+	app.ID = res.InsertedID.(primitive.ObjectID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(app.forCandidate())
+}
+
+// applicationPage returns one page of applications matching filter, newest
+// first, and the cursor of the next page.
+func applicationPage(ctx context.Context, filter bson.M, limit int, after bson.M) ([]Application, string, error) {
+	if after != nil {
+		filter = bson.M{"$and": bson.A{filter, after}}
+	}
+	cur, err := ApplicationsCol.Find(ctx, filter, options.Find().SetSort(pageSort).SetLimit(int64(limit+1)))
+	if err != nil {
+		return nil, "", err
+	}
+	defer cur.Close(ctx)
+
+	apps := []Application{}
+	if err := cur.All(ctx, &apps); err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(apps) > limit {
+		apps = apps[:limit]
+		last := apps[limit-1]
+		next = encodeCursor(last.CreatedAt, last.ID)
+	}
+	return apps, next, nil
+}
+
+// applicationStatusFilter reads ?status=, defaulting to active applications.
+func applicationStatusFilter(q url.Values) (string, bool) {
+	switch s := q.Get("status"); s {
+	case "":
+		return ApplicationActive, true
+	case ApplicationActive, ApplicationWithdrawn:
+		return s, true
+	}
+	return "", false
+}
+
+// ListMyApplications lists the caller's applications, withdrawn ones
+// included unless ?status= says otherwise, with a summary of each job.
+func ListMyApplications(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	q := r.URL.Query()
+	filter := bson.M{"candidateId": userID}
+	if q.Get("status") != "" {
+		status, ok := applicationStatusFilter(q)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "status must be active or withdrawn"})
+			return
+		}
+		filter["status"] = status
+	}
+	limit, after, err := pageParams(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	apps, next, err := applicationPage(ctx, filter, limit, after)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch applications"})
+		return
+	}
+
+	ids := make([]primitive.ObjectID, len(apps))
+	for i, a := range apps {
+		ids[i] = a.JobID
+	}
+	jobs := map[primitive.ObjectID]Job{}
+	found, err := findAllFor[Job](ctx, JobsCol, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch applications"})
+		return
+	}
+	for _, j := range found {
+		jobs[j.ID] = j
+	}
+
+	type jobSummary struct {
+		ID     primitive.ObjectID `json:"id"`
+		Title  string             `json:"title"`
+		Status string             `json:"status"`
+	}
+	type item struct {
+		Application
+		Job *jobSummary `json:"job,omitempty"`
+	}
+	items := make([]item, len(apps))
+	for i, a := range apps {
+		items[i] = item{Application: a.forCandidate()}
+		if j, ok := jobs[a.JobID]; ok {
+			items[i].Job = &jobSummary{ID: j.ID, Title: j.Title, Status: j.Status}
+		}
+	}
+
+	resp := map[string]interface{}{"applications": items}
+	if next != "" {
+		resp["nextCursor"] = next
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListApplicants lists the applications to a job, optionally in one
+// ?stage= or by ?knockedOut=, with each candidate's current profile. Only
+// the job's poster and admins may see them.
+func ListApplicants(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status, ok := applicationStatusFilter(q)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "status must be active or withdrawn"})
+		return
+	}
+	limit, after, err := pageParams(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := findJob(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+		return
+	}
+	if !canManageJob(r, job) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Only the poster of this job can see its applicants"})
+		return
+	}
+
+	filter := bson.M{"jobId": job.ID, "status": status}
+	switch q.Get("knockedOut") {
+	case "true":
+		filter["knockedOut"] = true
+	case "false":
+		filter["knockedOut"] = bson.M{"$ne": true}
+	}
+	if stage := q.Get("stage"); stage != "" {
+		if stage == StageApplied {
+			filter["stage"] = bson.M{"$in": bson.A{StageApplied, nil}}
+		} else {
+			filter["stage"] = stage
+		}
+	}
+	apps, next, err := applicationPage(ctx, filter, limit, after)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch applicants"})
+		return
+	}
+
+	candidates := make([]string, len(apps))
+	for i, a := range apps {
+		candidates[i] = a.CandidateID
+	}
+	profiles := map[string]Profile{}
+	found, err := findAllFor[Profile](ctx, ProfilesCol, bson.M{"userId": bson.M{"$in": candidates}})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch applicants"})
+		return
+	}
+	for _, p := range found {
+		profiles[p.UserID] = p
+	}
+
+	type item struct {
+		Application
+		Profile *Profile `json:"profile,omitempty"`
+	}
+	items := make([]item, len(apps))
+	for i, a := range apps {
+		items[i] = item{Application: a}
+		if p, ok := profiles[a.CandidateID]; ok {
+			items[i].Profile = &p
+		}
+	}
+
+	resp := map[string]interface{}{"applications": items}
+	if next != "" {
+		resp["nextCursor"] = next
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// findApplication loads an application the caller may see: their own, or
+// one to a job they manage. The job is returned for the latter check.
+func findApplication(ctx context.Context, r *http.Request, id string) (Application, Job, bool) {
+	var app Application
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return app, Job{}, false
+	}
+	if err := ApplicationsCol.FindOne(ctx, bson.M{"_id": oid}).Decode(&app); err != nil {
+		return app, Job{}, false
+	}
+	job, err := findJob(ctx, app.JobID.Hex())
+	if err != nil {
+		job = Job{ID: app.JobID}
+	}
+	userID, _ := r.Context().Value("userId").(string)
+	if app.CandidateID != userID && !canManageJob(r, job) {
+		return app, job, false
+	}
+	return app, job, true
+}
+
+// GetApplication returns one application to its candidate or to the job's
+// poster.
+func GetApplication(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	app, job, ok := findApplication(ctx, r, mux.Vars(r)["id"])
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Application not found"})
+		return
+	}
+	if !canManageJob(r, job) {
+		app = app.forCandidate()
+	}
+	json.NewEncoder(w).Encode(app)
+}
+
+// WithdrawApplication lets the candidate take back an application, unless
+// they have already been hired or rejected.
+func WithdrawApplication(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Application not found"})
+		return
+	}
+
+	now := time.Now()
+	var app Application
+	err = ApplicationsCol.FindOneAndUpdate(ctx,
+		bson.M{"_id": oid, "candidateId": userID, "status": ApplicationActive, "stage": bson.M{"$nin": decidedStages}},
+		bson.M{
+			"$set":  bson.M{"status": ApplicationWithdrawn, "withdrawnAt": now, "updatedAt": now},
+			"$push": bson.M{"timeline": ApplicationEvent{Type: EventWithdrawn, At: now}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&app)
+	if err == mongo.ErrNoDocuments {
+		n, err := ApplicationsCol.CountDocuments(ctx, bson.M{"_id": oid, "candidateId": userID, "status": ApplicationActive})
+		if err == nil && n > 0 {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "This application has already been decided and cannot be withdrawn",
+				"code":  "application_decided",
+			})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "No active application with that id"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to withdraw application"})
+		return
+	}
+	json.NewEncoder(w).Encode(app.forCandidate())
+}
+
+func RegisterApplicationRoutes(r *mux.Router) {
+	r.HandleFunc("/api/jobs/{id}/applications", ScopedAuth(ScopeApplicationsWrite)(RequireRole(RoleCandidate)(Apply))).Methods("POST")
+	r.HandleFunc("/api/jobs/{id}/applications", ScopedAuth(ScopeApplicationsRead)(RequireRole(RoleEmployer, RoleAdmin)(ListApplicants))).Methods("GET")
+	r.HandleFunc("/api/applications", ScopedAuth(ScopeApplicationsRead)(ListMyApplications)).Methods("GET")
+	r.HandleFunc("/api/applications/{id}", ScopedAuth(ScopeApplicationsRead)(GetApplication)).Methods("GET")
+	r.HandleFunc("/api/applications/{id}/withdraw", ScopedAuth(ScopeApplicationsWrite)(WithdrawApplication)).Methods("POST")
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEvent is an append-only record of a security-relevant event.
+type AuditEvent struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`
+	Event     string                 `bson:"event" json:"event"`
+	UserID    string                 `bson:"userId,omitempty" json:"userId,omitempty"`
+	IP        string                 `bson:"ip,omitempty" json:"ip,omitempty"`
+	Details   map[string]interface{} `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time              `bson:"createdAt" json:"createdAt"`
+}
+
+// recordAudit stores an audit event. Failures are logged, never returned:
+// auditing must not break the request that triggered it.
+func recordAudit(ctx context.Context, event AuditEvent) {
+	event.CreatedAt = time.Now()
+	if _, err := AuditLogCol.InsertOne(ctx, event); err != nil {
+		log.Printf("audit %s: %v", event.Event, err)
+	}
+}
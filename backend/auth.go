@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,26 +17,42 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret []byte
-
-func init() {
-	s := os.Getenv("JWT_SECRET")
-	if s == "" {
-		s = "change-me-in-production-secret-key"
-	}
-	jwtSecret = []byte(s)
-}
-
 type User struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Email     string             `bson:"email" json:"email"`
+	Email     string             `bson:"email,omitempty" json:"email"`
 	Password  string             `bson:"password" json:"-"` // never marshal to JSON
+	Role      string             `bson:"role" json:"role"`
 	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+
+	Verified           bool       `bson:"verified" json:"verified"`
+	VerifiedAt         *time.Time `bson:"verifiedAt,omitempty" json:"verifiedAt,omitempty"`
+	VerificationSentAt *time.Time `bson:"verificationSentAt,omitempty" json:"-"`
+	// PendingEmail is the new address of an email change until it is verified.
+	PendingEmail string `bson:"pendingEmail,omitempty" json:"pendingEmail,omitempty"`
+
+	// WalletAddress is set once the user proves ownership with SIWE. It is
+	// stored lowercase.
+	WalletAddress string `bson:"walletAddress,omitempty" json:"walletAddress,omitempty"`
+
+	// Identities are linked OIDC provider accounts.
+	Identities []Identity `bson:"identities,omitempty" json:"identities,omitempty"`
+
+	// TOTP two-factor authentication. Recovery codes are stored hashed.
+	TOTPEnabled       bool     `bson:"totpEnabled" json:"twoFactorEnabled"`
+	TOTPSecret        string   `bson:"totpSecret,omitempty" json:"-"`
+	TOTPPendingSecret string   `bson:"totpPendingSecret,omitempty" json:"-"`
+	TOTPLastStep      int64    `bson:"totpLastStep,omitempty" json:"-"`
+	RecoveryCodes     []string `bson:"recoveryCodes,omitempty" json:"-"`
+
+	// SessionVersion is embedded in access tokens; bumping it invalidates
+	// every token issued before.
+	SessionVersion int `bson:"sessionVersion" json:"-"`
 }
 
 type SignupRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Role     string `json:"role"` // candidate (default) or employer
 }
 
 type LoginRequest struct {
@@ -43,16 +61,29 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  struct {
-		ID    string `json:"id"`
-		Email string `json:"email"`
-	} `json:"user"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	ExpiresIn    int    `json:"expiresIn,omitempty"`
+	// Set instead of the tokens above when the account has 2FA enabled.
+	MFARequired bool       `json:"mfaRequired,omitempty"`
+	MFAToken    string     `json:"mfaToken,omitempty"`
+	User        *LoginUser `json:"user,omitempty"`
+}
+
+type LoginUser struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
 }
 
 type Claims struct {
-	UserID string `json:"userId"`
-	Email  string `json:"email"`
+	UserID         string `json:"userId"`
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	SessionID      string `json:"sid,omitempty"`
+	SessionVersion int    `json:"sv"`
+	// Purpose marks tokens that are not access tokens, such as MFA challenges.
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -82,12 +113,28 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !validEmail(req.Email) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "A valid email is required"})
+		return
+	}
+
 	if len(req.Password) < 6 {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Password must be at least 6 characters"})
 		return
 	}
 
+	// Admins are only created from the command line.
+	if req.Role == "" {
+		req.Role = RoleCandidate
+	}
+	if req.Role != RoleCandidate && req.Role != RoleEmployer {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Role must be candidate or employer"})
+		return
+	}
+
 	hashed, err := hashPassword(req.Password)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -98,13 +145,14 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 	user := User{
 		Email:     req.Email,
 		Password:  hashed,
+		Role:      req.Role,
 		CreatedAt: time.Now(),
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err = UsersCol.InsertOne(ctx, user)
+	res, err := UsersCol.InsertOne(ctx, user)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
 			w.WriteHeader(http.StatusConflict)
@@ -116,8 +164,13 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user.ID = res.InsertedID.(primitive.ObjectID)
+	if err := sendEmailVerification(ctx, user, user.Email); err != nil {
+		log.Println("signup: send verification:", err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "User created successfully"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "User created successfully. Please check your email to verify your address."})
 }
 
 func Login(w http.ResponseWriter, r *http.Request) {
@@ -139,10 +192,19 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	limitKeys := loginLimitKeys(r, req.Email)
+	if wait := loginLockedFor(ctx, limitKeys); wait > 0 {
+		setRetryAfter(w, wait)
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Too many failed login attempts. Please try again later."})
+		return
+	}
+
 	var user User
 	err := UsersCol.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
+			recordLoginFailure(ctx, r, limitKeys)
 			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid email or password"})
 			return
@@ -153,22 +215,14 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !checkPassword(req.Password, user.Password) {
+		recordLoginFailure(ctx, r, limitKeys)
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid email or password"})
 		return
 	}
+	resetLoginFailures(ctx, limitKeys)
 
-	claims := Claims{
-		UserID: user.ID.Hex(),
-		Email:  user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenStr, err := token.SignedString(jwtSecret)
+	resp, err := completeLogin(ctx, user, r.UserAgent())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create token"})
@@ -176,20 +230,115 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(LoginResponse{
-		Token: tokenStr,
-		User: struct {
-			ID    string `json:"id"`
-			Email string `json:"email"`
-		}{user.ID.Hex(), user.Email},
-	})
+	json.NewEncoder(w).Encode(resp)
+}
+
+func findUserByID(ctx context.Context, userID string) (User, error) {
+	var user User
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return user, mongo.ErrNoDocuments
+	}
+	err = UsersCol.FindOne(ctx, bson.M{"_id": oid}).Decode(&user)
+	return user, err
+}
+
+// parseAccessToken verifies the signature and expiry of an access token.
+func parseAccessToken(tokenStr string) (*Claims, error) {
+	token, err := keyring.Parse(tokenStr, &Claims{})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired token")
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || claims.Purpose != "" {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+// loadSessionUser fetches the account an access token belongs to. Tests
+// replace it to run the auth middleware without a database.
+var loadSessionUser = findUserByID
+
+// sessionUser loads the user behind a token. Tokens issued before the last
+// "log out everywhere" or password reset carry an outdated session version
+// and are rejected.
+func sessionUser(ctx context.Context, claims *Claims) (User, error) {
+	user, err := loadSessionUser(ctx, claims.UserID)
+	if err != nil {
+		return user, err
+	}
+	if user.SessionVersion != claims.SessionVersion {
+		return user, errors.New("session has been revoked")
+	}
+	return user, nil
+}
+
+// optionalUser returns the signed-in user for public endpoints that show
+// more to the owner of a resource. Missing or invalid tokens mean anonymous.
+func optionalUser(r *http.Request) (User, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return User{}, false
+	}
+	claims, err := parseAccessToken(auth[7:])
+	if err != nil {
+		return User{}, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	user, err := sessionUser(ctx, claims)
+	return user, err == nil
 }
 
 // JWTMiddleware validates JWT and sets user ID in request context
 func JWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return authMiddleware("", next)
+}
+
+// ScopedAuth is JWTMiddleware for routes that may also be called with a
+// personal API key. The key must carry the given scope; access tokens from an
+// interactive login are not restricted by scope.
+func ScopedAuth(scope string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return authMiddleware(scope, next)
+	}
+}
+
+func authMiddleware(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
+		if rawKey := apiKeyFromRequest(r); rawKey != "" {
+			if scope == "" {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"error": "API keys cannot be used for this endpoint", "code": "api_key_not_allowed"})
+				return
+			}
+
+			dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			user, key, err := authenticateAPIKey(dbCtx, rawKey)
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "Invalid, expired or revoked API key"})
+				return
+			}
+			if !key.hasScope(scope) {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"error": "API key is missing the " + scope + " scope", "code": "insufficient_scope"})
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "userId", user.ID.Hex())
+			ctx = context.WithValue(ctx, "userEmail", user.Email)
+			ctx = context.WithValue(ctx, "userRole", userRole(user))
+			ctx = context.WithValue(ctx, "apiKeyId", key.ID.Hex())
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		auth := r.Header.Get("Authorization")
 		if auth == "" || len(auth) < 8 || auth[:7] != "Bearer " {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -197,25 +346,26 @@ func JWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		tokenStr := auth[7:]
-		token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-		if err != nil || !token.Valid {
+		claims, err := parseAccessToken(auth[7:])
+		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid or expired token"})
 			return
 		}
 
-		claims, ok := token.Claims.(*Claims)
-		if !ok {
+		dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		user, err := sessionUser(dbCtx, claims)
+		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid token claims"})
+			json.NewEncoder(w).Encode(map[string]string{"error": "Session has been revoked"})
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), "userId", claims.UserID)
 		ctx = context.WithValue(ctx, "userEmail", claims.Email)
+		ctx = context.WithValue(ctx, "sessionId", claims.SessionID)
+		ctx = context.WithValue(ctx, "userRole", userRole(user))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const cliUsage = `usage:
+  job-portal                              start the HTTP server
+  job-portal create-admin <email> <password>
+  job-portal set-role <email> <candidate|employer|admin>
+  job-portal generate-key <rsa|ed25519> <path>`
+
+// runCLI runs a maintenance command against the database and returns the
+// process exit code. Admin accounts can only be created this way.
+func runCLI(args []string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch {
+	case args[0] == "create-admin" && len(args) == 3:
+		if len(args[2]) < 6 {
+			fmt.Fprintln(os.Stderr, "password must be at least 6 characters")
+			return 1
+		}
+		hashed, err := hashPassword(args[2])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "hash password:", err)
+			return 1
+		}
+		now := time.Now()
+		_, err = UsersCol.InsertOne(ctx, User{
+			Email:      args[1],
+			Password:   hashed,
+			Role:       RoleAdmin,
+			Verified:   true,
+			VerifiedAt: &now,
+			CreatedAt:  now,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "create admin:", err)
+			return 1
+		}
+		fmt.Println("admin created:", args[1])
+		return 0
+
+	case args[0] == "set-role" && len(args) == 3:
+		if !validRole(args[2]) {
+			fmt.Fprintln(os.Stderr, "role must be candidate, employer or admin")
+			return 1
+		}
+		res, err := UsersCol.UpdateOne(ctx, bson.M{"email": args[1]}, bson.M{"$set": bson.M{"role": args[2]}})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "set role:", err)
+			return 1
+		}
+		if res.MatchedCount == 0 {
+			fmt.Fprintln(os.Stderr, "no user with email", args[1])
+			return 1
+		}
+		fmt.Printf("%s is now %s\n", args[1], args[2])
+		return 0
+	}
+
+	fmt.Fprintln(os.Stderr, cliUsage)
+	return 2
+}
+
+// runKeyCLI handles commands that need neither the database nor the keyring.
+// It reports whether args named such a command.
+func runKeyCLI(args []string) (int, bool) {
+	if len(args) == 0 || args[0] != "generate-key" {
+		return 0, false
+	}
+	if len(args) != 3 {
+		fmt.Fprintln(os.Stderr, cliUsage)
+		return 2, true
+	}
+
+	var priv, pub interface{}
+	switch args[1] {
+	case "rsa":
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "generate key:", err)
+			return 1, true
+		}
+		priv, pub = k, &k.PublicKey
+	case "ed25519":
+		p, k, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "generate key:", err)
+			return 1, true
+		}
+		priv, pub = k, p
+	default:
+		fmt.Fprintln(os.Stderr, "key type must be rsa or ed25519")
+		return 2, true
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "marshal key:", err)
+		return 1, true
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "marshal key:", err)
+		return 1, true
+	}
+
+	path := args[2]
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, "write key:", err)
+		return 1, true
+	}
+	if err := os.WriteFile(path+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "write key:", err)
+		return 1, true
+	}
+	fmt.Printf("wrote %s and %s.pub\n", path, path)
+	return 0, true
+}
@@ -16,6 +16,21 @@ var (
 	ProfilesCol *mongo.Collection
 	JobsCol     *mongo.Collection
 	PaymentsCol *mongo.Collection
+	SessionsCol *mongo.Collection
+
+	PasswordResetsCol     *mongo.Collection
+	EmailVerificationsCol *mongo.Collection
+	SiweNoncesCol         *mongo.Collection
+	LoginAttemptsCol      *mongo.Collection
+	AuditLogCol           *mongo.Collection
+	OIDCStatesCol         *mongo.Collection
+	APIKeysCol            *mongo.Collection
+	ExportsCol            *mongo.Collection
+	ApplicationsCol       *mongo.Collection
+	SkillsCol             *mongo.Collection
+	SavedJobsCol          *mongo.Collection
+	BookmarksCol          *mongo.Collection
+	SavedSearchesCol      *mongo.Collection
 )
 
 func InitDB() {
@@ -41,12 +56,186 @@ func InitDB() {
 	ProfilesCol = DB.Collection("profiles")
 	JobsCol = DB.Collection("jobs")
 	PaymentsCol = DB.Collection("payments")
+	SessionsCol = DB.Collection("sessions")
+	PasswordResetsCol = DB.Collection("password_resets")
+	EmailVerificationsCol = DB.Collection("email_verifications")
+	SiweNoncesCol = DB.Collection("siwe_nonces")
+	LoginAttemptsCol = DB.Collection("login_attempts")
+	AuditLogCol = DB.Collection("audit_log")
+	OIDCStatesCol = DB.Collection("oidc_states")
+	ApplicationsCol = DB.Collection("applications")
+	SkillsCol = DB.Collection("skills")
+	SavedJobsCol = DB.Collection("saved_jobs")
+	BookmarksCol = DB.Collection("bookmarks")
+	SavedSearchesCol = DB.Collection("saved_searches")
+	APIKeysCol = DB.Collection("api_keys")
+	ExportsCol = DB.Collection("exports")
+
+	// Unique index on email for signup duplicate check. Sparse, because
+	// wallet-only accounts have no email.
+	migrateEmailIndex(context.Background())
+	_, err = UsersCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "walletAddress", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{
+			Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		log.Println("users indexes:", err)
+	}
+
+	// Refresh tokens are looked up by hash; expired sessions are purged by TTL
+	_, _ = SessionsCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	_, _ = PasswordResetsCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	_, _ = EmailVerificationsCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	_, _ = SiweNoncesCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "nonce", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	_, _ = LoginAttemptsCol.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	_, _ = AuditLogCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "event", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+	})
+
+	_, _ = OIDCStatesCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "stateHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	_, _ = APIKeysCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "keyHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+	})
 
-	// Unique index on email for signup duplicate check
-	_, _ = UsersCol.Indexes().CreateOne(context.Background(), mongo.IndexModel{
-		Keys:    bson.D{{Key: "email", Value: 1}},
-		Options: options.Index().SetUnique(true),
+	_, _ = ExportsCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		// One background export at a time per user
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "status", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": ExportPending}),
+		},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	// Cursor pagination and the filters of GET /api/jobs
+	_, _ = JobsCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		// The expiry sweeper
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expiresAt", Value: 1}}},
+		{Keys: bson.D{{Key: "skillKeys", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "postedBy", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "salaryMax", Value: 1}}},
+		{Keys: bson.D{{Key: "salaryMin", Value: 1}}},
+		// Full-text search; the weights match searchWeights in search.go.
+		{
+			Keys: bson.D{{Key: "title", Value: "text"}, {Key: "description", Value: "text"}, {Key: "skills", Value: "text"}},
+			Options: options.Index().SetName("job_text").
+				SetWeights(bson.M{"title": 10, "description": 4, "skills": 2}),
+		},
+	})
+
+	// One application per (job, candidate); the others serve the listings.
+	_, _ = ApplicationsCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "jobId", Value: 1}, {Key: "candidateId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "jobId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "jobId", Value: 1}, {Key: "status", Value: 1}, {Key: "stage", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "candidateId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+	})
+
+	// Matching candidates to a job's skills
+	_, _ = ProfilesCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "skillKeys", Value: 1}, {Key: "updatedAt", Value: -1}}},
+	})
+
+	// The skill taxonomy; aliases are kept distinct by the admin endpoints,
+	// as a unique multikey index would reject two skills without any.
+	_, _ = SkillsCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "aliases", Value: 1}}},
+	})
+
+	// One saved job per (user, job) and one bookmark per (employer,
+	// candidate); the others serve the listings and deletions.
+	_, _ = SavedJobsCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "jobId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "jobId", Value: 1}}},
+	})
+	_, _ = BookmarksCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "employerId", Value: 1}, {Key: "candidateId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "employerId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "candidateId", Value: 1}}},
+	})
+
+	// Saved searches: the owner's list, the alert scheduler and unsubscribe
+	// links.
+	_, _ = SavedSearchesCol.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "nextRunAt", Value: 1}}},
+		{Keys: bson.D{{Key: "unsubscribeTokens", Value: 1}}},
+	})
+	// Alerts look for jobs published since a search last ran.
+	_, _ = JobsCol.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "publishedAt", Value: -1}},
 	})
 
 	log.Println("MongoDB connected")
 }
+
+// migrateEmailIndex replaces the email index of databases created before
+// accounts without an email existed. That index is unique but not sparse, so
+// a second wallet-only account collides with the first on the missing email,
+// and creating the sparse one next to it fails together with the other users
+// indexes.
+func migrateEmailIndex(ctx context.Context) {
+	specs, err := UsersCol.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		log.Println("email index migration:", err)
+		return
+	}
+	for _, spec := range specs {
+		if spec.Name != "email_1" {
+			continue
+		}
+		if spec.Unique != nil && *spec.Unique && spec.Sparse != nil && *spec.Sparse {
+			return
+		}
+		// A sparse index still covers null, so accounts must not keep one.
+		if _, err := UsersCol.UpdateMany(ctx,
+			bson.M{"email": bson.M{"$in": bson.A{nil, ""}}},
+			bson.M{"$unset": bson.M{"email": ""}},
+		); err != nil {
+			log.Println("email index migration:", err)
+			return
+		}
+		if _, err := UsersCol.Indexes().DropOne(ctx, "email_1"); err != nil {
+			log.Println("email index migration:", err)
+			return
+		}
+		log.Println("Dropped the non-sparse email index; recreating it as unique and sparse")
+		return
+	}
+}
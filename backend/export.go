@@ -0,0 +1,382 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	exportTTL = 7 * 24 * time.Hour
+	// Accounts with more documents than this are always exported in the
+	// background.
+	exportSyncLimit = 1000
+	// Building an archive gives up after exportTimeout; a pending export older
+	// than that was lost, for example to a restart.
+	exportTimeout = 30 * time.Minute
+
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport tracks an archive built in the background.
+type DataExport struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID      string             `bson:"userId" json:"userId"`
+	Status      string             `bson:"status" json:"status"`
+	Error       string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	CompletedAt *time.Time         `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	ExpiresAt   time.Time          `bson:"expiresAt" json:"expiresAt"`
+}
+
+// exportSection is one JSON file of the archive.
+type exportSection struct {
+	Name string
+	Load func(ctx context.Context, userID string) (interface{}, error)
+}
+
+// exportSections lists everything tied to a user. Types are decoded through
+// their structs so fields tagged json:"-" (password, token hashes, TOTP
+// secrets) never reach the archive.
+var exportSections = []exportSection{
+	{"user.json", func(ctx context.Context, userID string) (interface{}, error) {
+		return findUserByID(ctx, userID)
+	}},
+	{"profile.json", func(ctx context.Context, userID string) (interface{}, error) {
+		return findAllFor[Profile](ctx, ProfilesCol, bson.M{"userId": userID})
+	}},
+	{"jobs.json", func(ctx context.Context, userID string) (interface{}, error) {
+		return findAllFor[Job](ctx, JobsCol, bson.M{"postedBy": userID})
+	}},
+	{"payments.json", func(ctx context.Context, userID string) (interface{}, error) {
+		return findAllFor[PaymentVerification](ctx, PaymentsCol, bson.M{"userId": userID})
+	}},
+	{"sessions.json", func(ctx context.Context, userID string) (interface{}, error) {
+		return findAllFor[Session](ctx, SessionsCol, bson.M{"userId": userID})
+	}},
+	{"api_keys.json", func(ctx context.Context, userID string) (interface{}, error) {
+		return findAllFor[APIKey](ctx, APIKeysCol, bson.M{"userId": userID})
+	}},
+	{"applications.json", func(ctx context.Context, userID string) (interface{}, error) {
+		apps, err := findAllFor[Application](ctx, ApplicationsCol, bson.M{"candidateId": userID})
+		for i := range apps {
+			apps[i] = apps[i].forCandidate()
+		}
+		return apps, err
+	}},
+	{"saved_jobs.json", func(ctx context.Context, userID string) (interface{}, error) {
+		return findAllFor[SavedJob](ctx, SavedJobsCol, bson.M{"userId": userID})
+	}},
+	{"saved_searches.json", func(ctx context.Context, userID string) (interface{}, error) {
+		return findAllFor[SavedSearch](ctx, SavedSearchesCol, bson.M{"userId": userID})
+	}},
+	{"bookmarks.json", func(ctx context.Context, userID string) (interface{}, error) {
+		return findAllFor[Bookmark](ctx, BookmarksCol, bson.M{"employerId": userID})
+	}},
+	{"audit_log.json", func(ctx context.Context, userID string) (interface{}, error) {
+		return findAllFor[AuditEvent](ctx, AuditLogCol, bson.M{"userId": userID})
+	}},
+}
+
+func findAllFor[T any](ctx context.Context, col *mongo.Collection, filter bson.M, opts ...*options.FindOptions) ([]T, error) {
+	cur, err := col.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []T{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// writeExport writes the zip archive of the user's data to w.
+func writeExport(ctx context.Context, w io.Writer, userID string) error {
+	zw := zip.NewWriter(w)
+	for _, section := range exportSections {
+		data, err := section.Load(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", section.Name, err)
+		}
+		f, err := zw.Create(section.Name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func exportDir() string {
+	dir := os.Getenv("EXPORT_DIR")
+	if dir == "" {
+		dir = "./exports"
+	}
+	return dir
+}
+
+func exportPath(id primitive.ObjectID) string {
+	return filepath.Join(exportDir(), id.Hex()+".zip")
+}
+
+// exportSize estimates how big an archive will be by counting documents.
+func exportSize(ctx context.Context, userID string) int64 {
+	var n int64
+	for _, q := range []struct {
+		col   *mongo.Collection
+		field string
+	}{{JobsCol, "postedBy"}, {PaymentsCol, "userId"}, {AuditLogCol, "userId"}, {SessionsCol, "userId"}, {ApplicationsCol, "candidateId"}, {SavedJobsCol, "userId"}, {BookmarksCol, "employerId"}, {SavedSearchesCol, "userId"}} {
+		c, _ := q.col.CountDocuments(ctx, bson.M{q.field: userID})
+		n += c
+	}
+	return n
+}
+
+// ExportData returns a zip of everything stored about the caller. With
+// ?async=true, or for large accounts, the archive is built in the background
+// and the user is emailed when it can be downloaded.
+func ExportData(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if r.URL.Query().Get("async") == "true" || exportSize(ctx, userID) > exportSyncLimit {
+		startAsyncExport(w, userID)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := writeExport(ctx, &buf, userID); err != nil {
+		log.Println("export:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to export data"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="rizeos-export-%s.zip"`, time.Now().Format("2006-01-02")))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func startAsyncExport(w http.ResponseWriter, userID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	export := DataExport{
+		UserID:    userID,
+		Status:    ExportPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(exportTTL),
+	}
+	// A partial unique index allows one pending export per user.
+	res, err := ExportsCol.InsertOne(ctx, export)
+	if mongo.IsDuplicateKeyError(err) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "An export is already being prepared",
+			"code":  "export_in_progress",
+		})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to start export"})
+		return
+	}
+	export.ID = res.InsertedID.(primitive.ObjectID)
+
+	go runExport(export)
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(export)
+}
+
+// runExport builds the archive on disk, records the outcome and notifies the
+// user.
+func runExport(export DataExport) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	err := func() error {
+		if err := os.MkdirAll(exportDir(), 0o700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(exportPath(export.ID), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		if err := writeExport(ctx, f, export.UserID); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}()
+
+	now := time.Now()
+	set := bson.M{"status": ExportReady, "completedAt": now}
+	if err != nil {
+		log.Println("export:", err)
+		os.Remove(exportPath(export.ID))
+		set = bson.M{"status": ExportFailed, "error": "Export failed", "completedAt": now}
+	}
+	res, uerr := ExportsCol.UpdateOne(ctx, bson.M{"_id": export.ID}, bson.M{"$set": set})
+	if uerr != nil {
+		log.Println("export:", uerr)
+		return
+	}
+	// The account was deleted while the archive was being built.
+	if res.MatchedCount == 0 {
+		os.Remove(exportPath(export.ID))
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	user, err := findUserByID(ctx, export.UserID)
+	if err != nil || user.Email == "" {
+		return
+	}
+	if err := mailer.Send(ctx, MailMessage{
+		To:      user.Email,
+		Subject: "Your data export is ready",
+		Body: fmt.Sprintf("The export of your RizeOS data is ready.\n\n"+
+			"Download it while signed in from:\n%s/api/me/exports/%s/download\n\n"+
+			"The link expires on %s.\n", appURL(), export.ID.Hex(), export.ExpiresAt.Format("2 Jan 2006")),
+	}); err != nil {
+		log.Println("export: notify:", err)
+	}
+}
+
+// StartExportCleaner removes expired archives every EXPORT_CLEANUP_INTERVAL
+// (1h by default).
+func StartExportCleaner() {
+	interval := time.Hour
+	if d, err := time.ParseDuration(os.Getenv("EXPORT_CLEANUP_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+	go func() {
+		for {
+			cleanupExpiredExports()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// cleanupExpiredExports removes archives whose export record has expired and
+// fails exports that were lost while pending, so their users can start a new
+// one.
+func cleanupExpiredExports() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	now := time.Now()
+	if _, err := ExportsCol.UpdateMany(ctx,
+		bson.M{"status": ExportPending, "createdAt": bson.M{"$lt": now.Add(-exportTimeout)}},
+		bson.M{"$set": bson.M{"status": ExportFailed, "error": "Export failed", "completedAt": now}},
+	); err != nil {
+		log.Println("export cleanup:", err)
+	}
+
+	removeExpiredExportFiles(exportDir(), now)
+}
+
+// removeExpiredExportFiles deletes the archives in dir that are past exportTTL.
+// Only files named like exportPath are touched; the age comes from the
+// export's ID, which matches the record's expiresAt.
+func removeExpiredExportFiles(dir string, now time.Time) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".zip")
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		id, err := primitive.ObjectIDFromHex(name)
+		if err != nil {
+			continue
+		}
+		if now.Sub(id.Timestamp()) > exportTTL {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+func findExport(ctx context.Context, r *http.Request) (DataExport, error) {
+	var export DataExport
+	userID, _ := r.Context().Value("userId").(string)
+	oid, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		return export, mongo.ErrNoDocuments
+	}
+	err = ExportsCol.FindOne(ctx, bson.M{"_id": oid, "userId": userID}).Decode(&export)
+	return export, err
+}
+
+func GetExport(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	export, err := findExport(ctx, r)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Export not found"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(export)
+}
+
+func DownloadExport(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	export, err := findExport(ctx, r)
+	if err != nil || time.Now().After(export.ExpiresAt) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Export not found"})
+		return
+	}
+	if export.Status != ExportReady {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Export is not ready", "status": export.Status})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="rizeos-export-%s.zip"`, export.CreatedAt.Format("2006-01-02")))
+	http.ServeFile(w, r, exportPath(export.ID))
+}
+
+func RegisterExportRoutes(r *mux.Router) {
+	r.HandleFunc("/api/me/export", JWTMiddleware(ExportData)).Methods("GET")
+	r.HandleFunc("/api/me/exports/{id}", JWTMiddleware(GetExport)).Methods("GET")
+	r.HandleFunc("/api/me/exports/{id}/download", JWTMiddleware(DownloadExport)).Methods("GET")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Only archives named after an export ID and past exportTTL are deleted;
+// anything else that happens to live in EXPORT_DIR is left alone.
+func TestRemoveExpiredExportFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	expired := primitive.NewObjectIDFromTimestamp(now.Add(-exportTTL - time.Hour)).Hex()
+	fresh := primitive.NewObjectIDFromTimestamp(now.Add(-time.Hour)).Hex()
+
+	files := map[string]bool{
+		expired + ".zip":  false,
+		fresh + ".zip":    true,
+		expired + ".txt":  true,
+		"backup.zip":      true,
+		"notes.txt":       true,
+		expired + "a.zip": true,
+	}
+	old := now.Add(-30 * 24 * time.Hour)
+	for name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, old, old)
+	}
+	subdir := primitive.NewObjectIDFromTimestamp(now.Add(-exportTTL-time.Hour)).Hex() + ".zip"
+	if err := os.Mkdir(filepath.Join(dir, subdir), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	removeExpiredExportFiles(dir, now)
+
+	for name, kept := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if (err == nil) != kept {
+			t.Errorf("%s: kept = %v, want %v", name, err == nil, kept)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, subdir)); err != nil {
+		t.Error("directory was removed")
+	}
+}
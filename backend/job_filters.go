@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxFilterSkills   = 20
+	maxFilterKeywords = 10
+)
+
+// JobFilter is the parsed form of the GET /api/jobs query string. The
+// grammar is documented in docs/api-routes.md.
+type JobFilter struct {
+	Skills      []string   `bson:"skills,omitempty" json:"skills,omitempty"`
+	MatchAll    bool       `bson:"matchAll,omitempty" json:"matchAll,omitempty"`
+	MinSalary   *float64   `bson:"minSalary,omitempty" json:"minSalary,omitempty"`
+	MaxSalary   *float64   `bson:"maxSalary,omitempty" json:"maxSalary,omitempty"`
+	Currency    string     `bson:"currency,omitempty" json:"currency,omitempty"`
+	PostedAfter *time.Time `bson:"postedAfter,omitempty" json:"postedAfter,omitempty"`
+	PostedBy    string     `bson:"postedBy,omitempty" json:"postedBy,omitempty"`
+	Keywords    []string   `bson:"keywords,omitempty" json:"keywords,omitempty"`
+	// Status is published unless the caller lists their own jobs.
+	Status string `bson:"status,omitempty" json:"status,omitempty"`
+}
+
+// parseJobFilter validates the filter parameters of q. postedBy=me is
+// resolved against the caller, so r must carry the optional login.
+func parseJobFilter(r *http.Request, q url.Values) (JobFilter, error) {
+	var f JobFilter
+
+	if s := q.Get("skills"); s != "" {
+		f.Skills = skillKeys(strings.Split(s, ","))
+		if len(f.Skills) > maxFilterSkills {
+			return f, fmt.Errorf("at most %d skills can be filtered on", maxFilterSkills)
+		}
+	}
+	switch q.Get("skillsMatch") {
+	case "", "any":
+	case "all":
+		f.MatchAll = true
+	default:
+		return f, errors.New("skillsMatch must be any or all")
+	}
+
+	var err error
+	if f.MinSalary, err = salaryParam(q, "minSalary"); err != nil {
+		return f, err
+	}
+	if f.MaxSalary, err = salaryParam(q, "maxSalary"); err != nil {
+		return f, err
+	}
+	if f.MinSalary != nil && f.MaxSalary != nil && *f.MinSalary > *f.MaxSalary {
+		return f, errors.New("minSalary cannot be greater than maxSalary")
+	}
+	if s := q.Get("currency"); s != "" {
+		f.Currency = strings.ToUpper(s)
+		if !validCurrency(f.Currency) {
+			return f, errors.New("currency must be an ISO 4217 code such as USD")
+		}
+	}
+	// Amounts are not converted between currencies, so a bound without one
+	// would compare 60000 JPY with 60000 USD.
+	if (f.MinSalary != nil || f.MaxSalary != nil) && f.Currency == "" {
+		return f, errors.New("minSalary and maxSalary require currency")
+	}
+
+	if s := q.Get("postedAfter"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", s)
+		}
+		if err != nil {
+			return f, errors.New("postedAfter must be a date (2006-01-02) or an RFC 3339 timestamp")
+		}
+		f.PostedAfter = &t
+	}
+
+	if s := q.Get("postedBy"); s != "" {
+		if s == "me" {
+			user, ok := optionalUser(r)
+			if !ok {
+				return f, errors.New("postedBy=me requires you to be logged in")
+			}
+			s = user.ID.Hex()
+		} else if _, err := primitive.ObjectIDFromHex(s); err != nil {
+			return f, errors.New("postedBy must be a user ID or me")
+		}
+		f.PostedBy = s
+	}
+
+	if s := q.Get("status"); s != "" && s != StatusPublished {
+		if !validJobStatus(s) {
+			return f, errors.New("status must be draft, published, paused, closed or expired")
+		}
+		user, ok := optionalUser(r)
+		if !ok || (f.PostedBy != user.ID.Hex() && userRole(user) != RoleAdmin) {
+			return f, errors.New("only your own jobs can be listed by status; add postedBy=me")
+		}
+		f.Status = s
+	}
+
+	f.Keywords = strings.Fields(strings.ToLower(q.Get("q")))
+	if len(f.Keywords) > maxFilterKeywords {
+		return f, fmt.Errorf("at most %d keywords are allowed", maxFilterKeywords)
+	}
+
+	return f, nil
+}
+
+func salaryParam(q url.Values, name string) (*float64, error) {
+	s := q.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%s must be a non-negative number", name)
+	}
+	return &n, nil
+}
+
+// bson turns the filter into a Mongo query. Every condition must hold, and
+// only published jobs match unless Status says otherwise.
+// Salary bounds compare annualized amounts, and jobs without salary amounts
+// never match them.
+func (f JobFilter) bson() bson.M {
+	and := bson.A{bson.M{"status": f.status()}}
+	if len(f.Skills) > 0 {
+		op := "$in"
+		if f.MatchAll {
+			op = "$all"
+		}
+		and = append(and, bson.M{"skillKeys": bson.M{op: f.Skills}})
+	}
+	// A job matches when its salary range overlaps the requested one.
+	if f.MinSalary != nil {
+		and = append(and, bson.M{"salaryMax": bson.M{"$gte": *f.MinSalary}})
+	}
+	if f.MaxSalary != nil {
+		and = append(and, bson.M{"salaryMin": bson.M{"$lte": *f.MaxSalary}})
+	}
+	if f.Currency != "" {
+		and = append(and, bson.M{"salary.currency": f.Currency})
+	}
+	if f.PostedAfter != nil {
+		and = append(and, bson.M{"createdAt": bson.M{"$gte": *f.PostedAfter}})
+	}
+	if f.PostedBy != "" {
+		and = append(and, bson.M{"postedBy": f.PostedBy})
+	}
+	for _, kw := range f.Keywords {
+		re := primitive.Regex{Pattern: regexp.QuoteMeta(kw), Options: "i"}
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"title": re},
+			bson.M{"description": re},
+			bson.M{"skillKeys": re},
+		}})
+	}
+	return bson.M{"$and": and}
+}
+
+func (f JobFilter) status() string {
+	if f.Status == "" {
+		return StatusPublished
+	}
+	return f.Status
+}
+
+// skillKeys canonicalizes (see skillKey) and de-duplicates skills so filters
+// can match them exactly (and use the index) regardless of how the poster
+// typed them.
+func skillKeys(skills []string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, s := range skills {
+		k := skillKey(s)
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// setFilterFields fills the derived fields the listing filters query.
+func (job *Job) setFilterFields() {
+	job.SkillKeys = skillKeys(job.Skills)
+	job.SalaryMin, job.SalaryMax = job.Salary.annualRange()
+}
+
+// BackfillJobFilterFields derives the filter fields for jobs stored before
+// they existed, and rewrites salaries still stored as free-form strings as
+// structured ones. It only touches such jobs, so it is cheap to run on every
+// start.
+func BackfillJobFilterFields() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	jobs, err := findAllFor[Job](ctx, JobsCol, bson.M{"$or": bson.A{
+		bson.M{"skillKeys": bson.M{"$exists": false}},
+		bson.M{"salary": bson.M{"$type": "string"}},
+	}})
+	if err != nil {
+		log.Println("job filter backfill:", err)
+		return
+	}
+	for _, job := range jobs {
+		job.setFilterFields()
+		set, unset := bson.M{"skillKeys": job.SkillKeys}, bson.M{}
+		if job.Salary != nil && *job.Salary != (Compensation{}) {
+			set["salary"] = job.Salary
+		} else {
+			unset["salary"] = ""
+		}
+		if job.SalaryMin != nil {
+			set["salaryMin"] = *job.SalaryMin
+			set["salaryMax"] = *job.SalaryMax
+		}
+		if _, err := JobsCol.UpdateByID(ctx, job.ID, bson.M{"$set": set, "$unset": unset}); err != nil {
+			log.Println("job filter backfill:", err)
+			return
+		}
+	}
+	if len(jobs) > 0 {
+		log.Printf("Migrated filter fields and salaries of %d jobs", len(jobs))
+	}
+}
+
+// matches evaluates the filter in memory, agreeing with bson.
+func (f JobFilter) matches(job Job) bool {
+	if job.Status != f.status() {
+		return false
+	}
+	if len(f.Skills) > 0 {
+		have := map[string]bool{}
+		for _, k := range job.SkillKeys {
+			have[k] = true
+		}
+		found := 0
+		for _, s := range f.Skills {
+			if have[s] {
+				found++
+			}
+		}
+		if found == 0 || (f.MatchAll && found < len(f.Skills)) {
+			return false
+		}
+	}
+	if f.MinSalary != nil && (job.SalaryMax == nil || *job.SalaryMax < *f.MinSalary) {
+		return false
+	}
+	if f.MaxSalary != nil && (job.SalaryMin == nil || *job.SalaryMin > *f.MaxSalary) {
+		return false
+	}
+	if f.Currency != "" && (job.Salary == nil || job.Salary.Currency != f.Currency) {
+		return false
+	}
+	if f.PostedAfter != nil && job.CreatedAt.Before(*f.PostedAfter) {
+		return false
+	}
+	if f.PostedBy != "" && job.PostedBy != f.PostedBy {
+		return false
+	}
+	for _, kw := range f.Keywords {
+		if !strings.Contains(strings.ToLower(job.Title), kw) &&
+			!strings.Contains(strings.ToLower(job.Description), kw) &&
+			!strings.Contains(strings.Join(job.SkillKeys, "\x00"), kw) {
+			return false
+		}
+	}
+	return true
+}
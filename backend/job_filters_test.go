@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseJobFilterSalary(t *testing.T) {
+	tests := []struct {
+		query string
+		ok    bool
+	}{
+		{"minSalary=60000&currency=usd", true},
+		{"maxSalary=90000&currency=EUR", true},
+		{"minSalary=60000&maxSalary=90000&currency=USD", true},
+		{"currency=USD", true},
+		{"minSalary=60000", false},
+		{"maxSalary=90000", false},
+		{"minSalary=90000&maxSalary=60000&currency=USD", false},
+		{"minSalary=-1&currency=USD", false},
+		{"minSalary=60000&currency=dollars", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			_, err := parseJobFilter(httptest.NewRequest(http.MethodGet, "/api/jobs", nil), q)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
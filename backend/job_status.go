@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Job statuses. Only published jobs are listed publicly.
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusPaused    = "paused"
+	StatusClosed    = "closed"
+	StatusExpired   = "expired"
+)
+
+// jobTransitions lists the statuses a poster can move a job to from each
+// status. Closed is final; expired is only ever set by the sweeper.
+var jobTransitions = map[string][]string{
+	StatusDraft:     {StatusPublished, StatusClosed},
+	StatusPublished: {StatusPaused, StatusClosed},
+	StatusPaused:    {StatusPublished, StatusClosed},
+	StatusExpired:   {StatusPublished, StatusClosed},
+}
+
+func validJobStatus(status string) bool {
+	switch status {
+	case StatusDraft, StatusPublished, StatusPaused, StatusClosed, StatusExpired:
+		return true
+	}
+	return false
+}
+
+func canTransition(from, to string) bool {
+	for _, s := range jobTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// maxJobLifetime bounds how far ahead a poster can set expiresAt.
+const maxJobLifetime = 90 * 24 * time.Hour
+
+// jobLifetime is how long a job stays published unless the poster picks an
+// expiry: JOB_LIFETIME_DAYS, 30 by default.
+func jobLifetime() time.Duration {
+	if n, err := strconv.Atoi(os.Getenv("JOB_LIFETIME_DAYS")); err == nil && n > 0 {
+		if d := time.Duration(n) * 24 * time.Hour; d < maxJobLifetime {
+			return d
+		}
+		return maxJobLifetime
+	}
+	return 30 * 24 * time.Hour
+}
+
+// publishExpiry picks the expiry of a job being published now. A requested
+// time must lie in the future and within maxJobLifetime.
+func publishExpiry(now time.Time, requested *time.Time) (time.Time, error) {
+	if requested == nil {
+		return now.Add(jobLifetime()), nil
+	}
+	if !requested.After(now) {
+		return time.Time{}, errExpiryPast
+	}
+	if requested.Sub(now) > maxJobLifetime {
+		return time.Time{}, errExpiryTooFar
+	}
+	return *requested, nil
+}
+
+var (
+	errInvalidTransition = errors.New("invalid status transition")
+	errJobChanged        = errors.New("job changed concurrently")
+	errExpiryPast        = errors.New("expiresAt must be in the future")
+	errExpiryTooFar      = errors.New("expiresAt can be at most 90 days ahead")
+)
+
+// transitionJob moves job to status to. It only succeeds if the job is
+// still in the status it was read with, so concurrent transitions cannot
+// both win. Publishing sets expiresAt; resuming a paused job keeps the
+// expiry it had unless a new one is given.
+func transitionJob(ctx context.Context, job Job, to string, expiresAt *time.Time) (Job, error) {
+	if !canTransition(job.Status, to) {
+		return job, errInvalidTransition
+	}
+
+	now := time.Now()
+	set := bson.M{"status": to, "statusChangedAt": now, "updatedAt": now}
+	switch to {
+	case StatusPublished:
+		if job.PublishedAt == nil {
+			set["publishedAt"] = now
+		}
+		if job.Status != StatusPaused || expiresAt != nil || job.ExpiresAt == nil || !job.ExpiresAt.After(now) {
+			exp, err := publishExpiry(now, expiresAt)
+			if err != nil {
+				return job, err
+			}
+			set["expiresAt"] = exp
+		}
+	case StatusClosed:
+		set["closedAt"] = now
+	}
+
+	var updated Job
+	err := JobsCol.FindOneAndUpdate(ctx,
+		bson.M{"_id": job.ID, "status": job.Status},
+		bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return job, errJobChanged
+	}
+	if err != nil {
+		return job, err
+	}
+	reindexJob(ctx, updated)
+	return updated, nil
+}
+
+type JobStatusRequest struct {
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Version   *int       `json:"version"`
+}
+
+// SetJobStatus moves a job through its lifecycle, e.g. publishing a draft
+// or pausing a listing. If-Match (or "version") is honoured when sent.
+func SetJobStatus(w http.ResponseWriter, r *http.Request) {
+	var req JobStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if !validJobStatus(req.Status) || req.Status == StatusExpired {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "status must be draft, published, paused or closed"})
+		return
+	}
+	if req.ExpiresAt != nil && req.Status != StatusPublished {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "expiresAt can only be set when publishing"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := findJob(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+		return
+	}
+	if !canManageJob(r, job) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Only the poster of this job can change its status"})
+		return
+	}
+	if version, ok := expectedVersion(r, req.Version); ok && version != job.Version {
+		w.Header().Set("ETag", jobETag(job))
+		w.WriteHeader(http.StatusPreconditionFailed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The job was changed by someone else. Reload it and try again.", "code": "version_conflict"})
+		return
+	}
+
+	updated, err := transitionJob(ctx, job, req.Status, req.ExpiresAt)
+	writeTransitionResult(w, job, updated, req.Status, err)
+}
+
+// writeTransitionResult answers a status change the same way for every
+// endpoint that makes one.
+func writeTransitionResult(w http.ResponseWriter, job, updated Job, to string, err error) {
+	switch {
+	case err == errInvalidTransition:
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   "A " + job.Status + " job cannot be moved to " + to,
+			"code":    "invalid_transition",
+			"status":  job.Status,
+			"allowed": jobTransitions[job.Status],
+		})
+	case err == errJobChanged:
+		w.WriteHeader(http.StatusPreconditionFailed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The job was changed by someone else. Reload it and try again.", "code": "version_conflict"})
+	case err == errExpiryPast || err == errExpiryTooFar:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to change job status"})
+	default:
+		w.Header().Set("ETag", jobETag(updated))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(updated)
+	}
+}
+
+// MigrateJobStatus gives jobs stored before statuses existed one: closed if
+// they were closed, otherwise published with a fresh lifetime.
+func MigrateJobStatus() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	noStatus := bson.M{"status": bson.M{"$exists": false}}
+	closed, err := JobsCol.UpdateMany(ctx,
+		bson.M{"status": bson.M{"$exists": false}, "closedAt": bson.M{"$exists": true}},
+		bson.M{"$set": bson.M{"status": StatusClosed}},
+	)
+	if err != nil {
+		log.Println("job status migration:", err)
+		return
+	}
+	published, err := JobsCol.UpdateMany(ctx, noStatus, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"status":      StatusPublished,
+			"publishedAt": "$createdAt",
+			"expiresAt":   time.Now().Add(jobLifetime()),
+		}}},
+	})
+	if err != nil {
+		log.Println("job status migration:", err)
+		return
+	}
+	if n := closed.ModifiedCount + published.ModifiedCount; n > 0 {
+		log.Printf("Gave %d existing jobs a status", n)
+	}
+}
+
+// StartJobSweeper expires published and paused jobs whose expiresAt has
+// passed, checking every JOB_SWEEP_INTERVAL (5m by default).
+func StartJobSweeper() {
+	interval := 5 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("JOB_SWEEP_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if n, err := sweepExpiredJobs(ctx); err != nil {
+				log.Println("job sweeper:", err)
+			} else if n > 0 {
+				log.Printf("Expired %d jobs", n)
+			}
+			cancel()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func sweepExpiredJobs(ctx context.Context) (int, error) {
+	now := time.Now()
+	due := bson.M{
+		"status":    bson.M{"$in": bson.A{StatusPublished, StatusPaused}},
+		"expiresAt": bson.M{"$lte": now},
+	}
+
+	jobs, err := findAllFor[Job](ctx, JobsCol, due)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, job := range jobs {
+		// Re-check the status so a job paused or closed meanwhile is left alone.
+		res, err := JobsCol.UpdateOne(ctx,
+			bson.M{"_id": job.ID, "status": job.Status, "expiresAt": bson.M{"$lte": now}},
+			bson.M{
+				"$set": bson.M{"status": StatusExpired, "statusChangedAt": now, "updatedAt": now},
+				"$inc": bson.M{"version": 1},
+			},
+		)
+		if err != nil {
+			return expired, err
+		}
+		if res.ModifiedCount > 0 {
+			unindexJob(ctx, job.ID)
+			expired++
+		}
+	}
+	return expired, nil
+}
@@ -3,12 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -17,18 +22,55 @@ type Job struct {
 	Title       string             `bson:"title" json:"title"`
 	Description string             `bson:"description" json:"description"`
 	Skills      []string           `bson:"skills" json:"skills"`
-	Salary      string             `bson:"salary" json:"salary"`
+	Salary      *Compensation      `bson:"salary,omitempty" json:"salary,omitempty"`
 	PostedBy    string             `bson:"postedBy" json:"postedBy"`
 	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   *time.Time         `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+	ClosedAt    *time.Time         `bson:"closedAt,omitempty" json:"closedAt,omitempty"`
+	// Status is one of the Status* constants; see job_status.go.
+	Status          string     `bson:"status" json:"status"`
+	StatusChangedAt *time.Time `bson:"statusChangedAt,omitempty" json:"statusChangedAt,omitempty"`
+	PublishedAt     *time.Time `bson:"publishedAt,omitempty" json:"publishedAt,omitempty"`
+	ExpiresAt       *time.Time `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	// Pipeline is the hiring stages applications move through; empty means
+	// defaultPipeline.
+	Pipeline []string `bson:"pipeline,omitempty" json:"pipeline,omitempty"`
+	// Questions are asked when applying; see screening.go.
+	Questions []Question `bson:"questions,omitempty" json:"questions,omitempty"`
+	// Version is bumped on every change and doubles as the ETag.
+	Version int `bson:"version" json:"version"`
+
+	// Derived from Skills and Salary for the listing filters; the salary
+	// bounds are annualized.
+	SkillKeys []string `bson:"skillKeys" json:"-"`
+	SalaryMin *float64 `bson:"salaryMin,omitempty" json:"-"`
+	SalaryMax *float64 `bson:"salaryMax,omitempty" json:"-"`
+}
+
+// UpdateJobRequest is the body of PUT (all fields) and PATCH (only the fields
+// present) on /api/jobs/{id}. Version may be sent instead of If-Match.
+type UpdateJobRequest struct {
+	Title       *string       `json:"title"`
+	Description *string       `json:"description"`
+	Skills      *[]string     `json:"skills"`
+	Salary      *Compensation `json:"salary"`
+	Questions   *[]Question   `json:"questions"`
+	Version     *int          `json:"version"`
 }
 
 type CreateJobRequest struct {
-	Title         string   `json:"title"`
-	Description   string   `json:"description"`
-	Skills        []string `json:"skills"`
-	Salary        string   `json:"salary"`
-	WalletAddress string   `json:"walletAddress"`
-	PaymentTxHash string   `json:"paymentTxHash"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Skills      []string      `json:"skills"`
+	Salary      *Compensation `json:"salary"`
+	// Status is draft or published (the default).
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// Pipeline is optional; see validatePipeline.
+	Pipeline      []string   `json:"pipeline"`
+	Questions     []Question `json:"questions"`
+	WalletAddress string     `json:"walletAddress"`
+	PaymentTxHash string     `json:"paymentTxHash"`
 }
 
 func CreateJob(w http.ResponseWriter, r *http.Request) {
@@ -39,6 +81,24 @@ func CreateJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	poster, err := findUserByID(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+	if !poster.Verified {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Please verify your email address before posting jobs",
+			"code":  "email_not_verified",
+		})
+		return
+	}
+
 	var req CreateJobRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -51,6 +111,41 @@ func CreateJob(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]string{"error": "Title is required"})
 		return
 	}
+	if req.Salary != nil {
+		if err := req.Salary.validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if *req.Salary == (Compensation{}) {
+			req.Salary = nil
+		}
+	}
+	if req.Pipeline != nil {
+		if err := validatePipeline(req.Pipeline); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if err := validateQuestions(req.Questions); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if req.Status == "" {
+		req.Status = StatusPublished
+	}
+	if req.Status != StatusDraft && req.Status != StatusPublished {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "status must be draft or published"})
+		return
+	}
+	if req.ExpiresAt != nil && req.Status != StatusPublished {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "expiresAt can only be set when publishing"})
+		return
+	}
 
 	// 🔕 Wallet & payment validation DISABLED for demo / assignment
 	// In production, enable this block to enforce platform fee
@@ -80,17 +175,29 @@ func CreateJob(w http.ResponseWriter, r *http.Request) {
 		}
 	*/
 
+	now := time.Now()
 	job := Job{
 		Title:       req.Title,
 		Description: req.Description,
-		Skills:      req.Skills,
+		Skills:      normalizeSkills(req.Skills),
 		Salary:      req.Salary,
 		PostedBy:    userID,
-		CreatedAt:   time.Now(),
+		CreatedAt:   now,
+		Status:      req.Status,
+		Pipeline:    req.Pipeline,
+		Questions:   req.Questions,
+		Version:     1,
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	if job.Status == StatusPublished {
+		exp, err := publishExpiry(now, req.ExpiresAt)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		job.PublishedAt, job.ExpiresAt = &now, &exp
+	}
+	job.setFilterFields()
 
 	res, err := JobsCol.InsertOne(ctx, job)
 	if err != nil {
@@ -100,19 +207,58 @@ func CreateJob(w http.ResponseWriter, r *http.Request) {
 	}
 
 	job.ID = res.InsertedID.(primitive.ObjectID)
+	reindexJob(ctx, job)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", jobETag(job))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(job)
 }
 
+// JobPage is one page of GET /api/jobs. NextCursor is empty on the last page.
+type JobPage struct {
+	Jobs       []Job  `json:"jobs"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// GetJobs lists published jobs matching the query filters, newest first, one
+// page at a time. Pass the nextCursor of a page as ?cursor= to get the next one.
 func GetJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	q := r.URL.Query()
+	limit, err := pageSize(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	jf, err := parseJobFilter(r, q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	filter := bson.M{"$and": bson.A{jf.bson()}}
+	if c := q.Get("cursor"); c != "" {
+		after, err := cursorFilter(c)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		filter["$and"] = append(filter["$and"].(bson.A), after)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// One extra document tells whether there is a next page.
 	cur, err := JobsCol.Find(
 		ctx,
-		bson.M{},
-		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+		filter,
+		options.Find().SetSort(pageSort).SetLimit(int64(limit+1)),
 	)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -128,15 +274,309 @@ func GetJobs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if jobList == nil {
-		jobList = []Job{}
+	manages := jobViewer(r)
+	for i := range jobList {
+		if !manages(jobList[i]) {
+			jobList[i].Questions = publicQuestions(jobList[i].Questions)
+		}
+	}
+
+	page := JobPage{Jobs: jobList}
+	if len(jobList) > limit {
+		page.Jobs = jobList[:limit]
+		last := page.Jobs[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	if page.Jobs == nil {
+		page.Jobs = []Job{}
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
+
+func jobETag(job Job) string {
+	return fmt.Sprintf(`"%d"`, job.Version)
+}
+
+// expectedVersion reads the version the client last saw, from If-Match or
+// the request body.
+func expectedVersion(r *http.Request, body *int) (int, bool) {
+	if m := strings.Trim(r.Header.Get("If-Match"), `W/" `); m != "" {
+		v, err := strconv.Atoi(m)
+		return v, err == nil
+	}
+	if body != nil {
+		return *body, true
 	}
+	return 0, false
+}
 
+// versionFilter matches a job at the given version. Jobs created before
+// versioning have no version field and count as version 0.
+func versionFilter(id primitive.ObjectID, version int) bson.M {
+	if version == 0 {
+		return bson.M{"_id": id, "$or": bson.A{bson.M{"version": 0}, bson.M{"version": bson.M{"$exists": false}}}}
+	}
+	return bson.M{"_id": id, "version": version}
+}
+
+func canManageJob(r *http.Request, job Job) bool {
+	userID, _ := r.Context().Value("userId").(string)
+	role, _ := r.Context().Value("userRole").(string)
+	return job.PostedBy == userID || role == RoleAdmin
+}
+
+func findJob(ctx context.Context, id string) (Job, error) {
+	var job Job
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return job, mongo.ErrNoDocuments
+	}
+	err = JobsCol.FindOne(ctx, bson.M{"_id": oid}).Decode(&job)
+	return job, err
+}
+
+// GetJob returns one job. Jobs that are not published are only visible to
+// their poster and admins.
+func GetJob(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(jobList)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := findJob(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch job"})
+		return
+	}
+
+	if job.Status != StatusPublished {
+		user, ok := optionalUser(r)
+		if !ok || (user.ID.Hex() != job.PostedBy && userRole(user) != RoleAdmin) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+			return
+		}
+	}
+
+	if !jobViewer(r)(job) {
+		job.Questions = publicQuestions(job.Questions)
+	}
+
+	w.Header().Set("ETag", jobETag(job))
+	json.NewEncoder(w).Encode(job)
+}
+
+// UpdateJob handles PUT and PATCH. The client must send the version it is
+// editing (If-Match or "version"); a stale version gets 412 so concurrent
+// edits are never silently lost.
+func UpdateJob(w http.ResponseWriter, r *http.Request) {
+	var req UpdateJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if r.Method == http.MethodPut && (req.Title == nil || req.Description == nil || req.Skills == nil || req.Salary == nil) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "PUT requires title, description, skills and salary; use PATCH for partial updates"})
+		return
+	}
+
+	version, ok := expectedVersion(r, req.Version)
+	if !ok {
+		w.WriteHeader(http.StatusPreconditionRequired)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Send the job version in If-Match or the version field"})
+		return
+	}
+
+	set := bson.M{}
+	if req.Title != nil {
+		if strings.TrimSpace(*req.Title) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Title is required"})
+			return
+		}
+		set["title"] = *req.Title
+	}
+	if req.Description != nil {
+		set["description"] = *req.Description
+	}
+	unset := bson.M{}
+	if req.Questions != nil {
+		if err := validateQuestions(*req.Questions); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		set["questions"] = *req.Questions
+	}
+	if req.Skills != nil {
+		skills := normalizeSkills(*req.Skills)
+		set["skills"] = skills
+		set["skillKeys"] = skillKeys(skills)
+	}
+	if req.Salary != nil {
+		if err := req.Salary.validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if *req.Salary == (Compensation{}) {
+			unset["salary"] = ""
+		} else {
+			set["salary"] = *req.Salary
+		}
+		if min, max := req.Salary.annualRange(); min != nil {
+			set["salaryMin"], set["salaryMax"] = *min, *max
+		} else {
+			unset["salaryMin"], unset["salaryMax"] = "", ""
+		}
+	}
+	if len(set) == 0 && len(unset) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Nothing to update"})
+		return
+	}
+	set["updatedAt"] = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := findJob(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+		return
+	}
+	if !canManageJob(r, job) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Only the poster of this job can change it"})
+		return
+	}
+
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var updated Job
+	err = JobsCol.FindOneAndUpdate(ctx,
+		versionFilter(job.ID, version),
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			w.Header().Set("ETag", jobETag(job))
+			w.WriteHeader(http.StatusPreconditionFailed)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":   "The job was changed by someone else. Reload it and try again.",
+				"code":    "version_conflict",
+				"version": job.Version,
+			})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update job"})
+		return
+	}
+
+	reindexJob(ctx, updated)
+	w.Header().Set("ETag", jobETag(updated))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// CloseJob takes a posting off the public listing without deleting it. It is
+// shorthand for setting the status to closed.
+func CloseJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := findJob(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+		return
+	}
+	if !canManageJob(r, job) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Only the poster of this job can close it"})
+		return
+	}
+	if job.Status == StatusClosed {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Job is already closed"})
+		return
+	}
+
+	updated, err := transitionJob(ctx, job, StatusClosed, nil)
+	writeTransitionResult(w, job, updated, StatusClosed, err)
+}
+
+// DeleteJob removes a posting, and the applications to it, for good.
+// If-Match is honoured when sent.
+func DeleteJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := findJob(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+		return
+	}
+	if !canManageJob(r, job) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Only the poster of this job can delete it"})
+		return
+	}
+
+	filter := bson.M{"_id": job.ID}
+	if version, ok := expectedVersion(r, nil); ok {
+		filter = versionFilter(job.ID, version)
+	}
+
+	res, err := JobsCol.DeleteOne(ctx, filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete job"})
+		return
+	}
+	if res.DeletedCount == 0 {
+		w.Header().Set("ETag", jobETag(job))
+		w.WriteHeader(http.StatusPreconditionFailed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The job was changed by someone else. Reload it and try again.", "code": "version_conflict"})
+		return
+	}
+
+	unindexJob(ctx, job.ID)
+	// Applications to a deleted job have nothing left to point at, and
+	// neither do saves of it.
+	if _, err := ApplicationsCol.DeleteMany(ctx, bson.M{"jobId": job.ID}); err != nil {
+		log.Println("deleting applications of job", job.ID.Hex()+":", err)
+	}
+	if _, err := SavedJobsCol.DeleteMany(ctx, bson.M{"jobId": job.ID}); err != nil {
+		log.Println("deleting saves of job", job.ID.Hex()+":", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func RegisterJobRoutes(r *mux.Router) {
-	r.HandleFunc("/api/jobs", JWTMiddleware(CreateJob)).Methods("POST")
+	r.HandleFunc("/api/jobs", ScopedAuth(ScopeJobsWrite)(RequireRole(RoleEmployer, RoleAdmin)(CreateJob))).Methods("POST")
 	r.HandleFunc("/api/jobs", GetJobs).Methods("GET")
+	r.HandleFunc("/api/jobs/search", SearchJobs).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}", GetJob).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}", ScopedAuth(ScopeJobsWrite)(UpdateJob)).Methods("PUT", "PATCH")
+	r.HandleFunc("/api/jobs/{id}", ScopedAuth(ScopeJobsWrite)(DeleteJob)).Methods("DELETE")
+	r.HandleFunc("/api/jobs/{id}/close", ScopedAuth(ScopeJobsWrite)(CloseJob)).Methods("POST")
+	r.HandleFunc("/api/jobs/{id}/status", ScopedAuth(ScopeJobsWrite)(SetJobStatus)).Methods("POST")
 }
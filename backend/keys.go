@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	devJWTSecret = "change-me-in-production-secret-key"
+	// legacyKid identifies the shared HS256 secret. Tokens without a kid
+	// header were signed with it.
+	legacyKid = "hs256"
+)
+
+// signingKey is one entry of the keyring. Private is nil for keys that are
+// only kept to verify tokens signed before a rotation.
+type signingKey struct {
+	Kid     string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// Keyring holds every key tokens may be signed with, identified by kid. New
+// tokens are signed with the active key; older keys stay available for
+// verification so rotating does not log anyone out.
+type Keyring struct {
+	keys   map[string]*signingKey
+	active string
+}
+
+var keyring *Keyring
+
+// InitKeys loads the keyring from the environment:
+//
+//	JWT_KEYS         comma-separated kid=path pairs of PEM private keys (RSA or Ed25519)
+//	JWT_PUBLIC_KEYS  comma-separated kid=path pairs of PEM public keys of retired keys
+//	JWT_ACTIVE_KID   kid to sign new tokens with (defaults to the first of JWT_KEYS)
+//	JWT_SECRET       legacy HS256 secret, used to sign only when there is no other key
+//
+// With APP_ENV=production the server refuses to start without a configured key.
+func InitKeys() {
+	kr, err := loadKeyring()
+	if err != nil {
+		log.Fatal("JWT keys: ", err)
+	}
+	keyring = kr
+	log.Printf("JWT signing key: %s (%s)", kr.active, kr.keys[kr.active].Method.Alg())
+}
+
+func loadKeyring() (*Keyring, error) {
+	kr := &Keyring{keys: map[string]*signingKey{}}
+
+	for _, entry := range splitKeyList(os.Getenv("JWT_KEYS")) {
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok || kid == "" {
+			return nil, fmt.Errorf("JWT_KEYS entry %q must be kid=path", entry)
+		}
+		key, err := loadPrivateKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		kr.keys[kid] = key
+		if kr.active == "" {
+			kr.active = kid
+		}
+	}
+
+	for _, entry := range splitKeyList(os.Getenv("JWT_PUBLIC_KEYS")) {
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok || kid == "" {
+			return nil, fmt.Errorf("JWT_PUBLIC_KEYS entry %q must be kid=path", entry)
+		}
+		if _, exists := kr.keys[kid]; exists {
+			return nil, fmt.Errorf("duplicate kid %q", kid)
+		}
+		key, err := loadPublicKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		kr.keys[kid] = key
+	}
+
+	secret := os.Getenv("JWT_SECRET")
+	production := os.Getenv("APP_ENV") == "production"
+	if secret == "" && len(kr.keys) == 0 {
+		if production {
+			return nil, errors.New("JWT_KEYS or JWT_SECRET must be set in production")
+		}
+		log.Println("WARNING: no JWT key configured, using the insecure development secret")
+		secret = devJWTSecret
+	}
+	if production && secret == devJWTSecret {
+		return nil, errors.New("refusing to use the development JWT secret in production")
+	}
+	if secret != "" {
+		kr.keys[legacyKid] = &signingKey{
+			Kid:     legacyKid,
+			Method:  jwt.SigningMethodHS256,
+			Private: []byte(secret),
+			Public:  []byte(secret),
+		}
+		if kr.active == "" {
+			kr.active = legacyKid
+		}
+	}
+
+	if kid := os.Getenv("JWT_ACTIVE_KID"); kid != "" {
+		key, ok := kr.keys[kid]
+		if !ok || key.Private == nil {
+			return nil, fmt.Errorf("JWT_ACTIVE_KID %q is not a configured private key", kid)
+		}
+		kr.active = kid
+	}
+	return kr, nil
+}
+
+func splitKeyList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return block, nil
+}
+
+func loadPrivateKey(kid, path string) (*signingKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed interface{}
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &signingKey{Kid: kid, Method: jwt.SigningMethodRS256, Private: k, Public: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{Kid: kid, Method: jwt.SigningMethodEdDSA, Private: k, Public: k.Public()}, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported key type %T", path, parsed)
+}
+
+func loadPublicKey(kid, path string) (*signingKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PublicKey:
+		return &signingKey{Kid: kid, Method: jwt.SigningMethodRS256, Public: k}, nil
+	case ed25519.PublicKey:
+		return &signingKey{Kid: kid, Method: jwt.SigningMethodEdDSA, Public: k}, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported key type %T", path, parsed)
+}
+
+// Sign signs claims with the active key and records its kid in the header.
+func (kr *Keyring) Sign(claims jwt.Claims) (string, error) {
+	key := kr.keys[kr.active]
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.Kid
+	return token.SignedString(key.Private)
+}
+
+// Parse verifies a token with the key named by its kid header. The algorithm
+// must match the key's, so a public key can never be used as an HMAC secret.
+func (kr *Keyring) Parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			kid = legacyKid
+		}
+		key, ok := kr.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return key.Public, nil
+	})
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public half of every asymmetric key. The HS256 secret is
+// never published.
+func (kr *Keyring) JWKS() []JWK {
+	keys := []JWK{}
+	for _, key := range kr.keys {
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "RSA",
+				Kid: key.Kid,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "OKP",
+				Kid: key.Kid,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+	return keys
+}
+
+// JWKSHandler serves the public keys so other services can verify our tokens.
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keyring.JWKS()})
+}
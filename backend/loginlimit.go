@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginLimitPolicy describes how many failures are tolerated for a key before
+// it is locked out, and for how long. Every failure past the threshold
+// doubles the lockout, up to MaxLockout.
+type LoginLimitPolicy struct {
+	FreeAttempts int
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+	// Forget is how long a key's failures are remembered after the last one.
+	Forget time.Duration
+}
+
+var (
+	// Per-account limits are strict; per-IP limits are looser because many
+	// users can share an address.
+	emailLimitPolicy = LoginLimitPolicy{FreeAttempts: 5, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Forget: 24 * time.Hour}
+	ipLimitPolicy    = LoginLimitPolicy{FreeAttempts: 20, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Forget: 24 * time.Hour}
+)
+
+func (p LoginLimitPolicy) lockout(failures int) time.Duration {
+	over := failures - p.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	d := time.Duration(float64(p.BaseLockout) * math.Pow(2, float64(over-1)))
+	if d > p.MaxLockout || d <= 0 {
+		d = p.MaxLockout
+	}
+	return d
+}
+
+// AttemptState is the failure count of a key and the end of its lockout.
+type AttemptState struct {
+	Failures    int       `bson:"failures"`
+	LockedUntil time.Time `bson:"lockedUntil"`
+}
+
+// LoginAttemptStore tracks failed login attempts. The Mongo store is shared
+// between instances; the memory store is enough for a single node.
+type LoginAttemptStore interface {
+	Get(ctx context.Context, key string) (AttemptState, error)
+	RecordFailure(ctx context.Context, key string, policy LoginLimitPolicy) (AttemptState, error)
+	Reset(ctx context.Context, key string) error
+}
+
+var loginAttempts LoginAttemptStore
+
+// InitLoginLimiter picks the attempt store from LOGIN_LIMITER_STORE: "mongo"
+// (the default) or "memory".
+func InitLoginLimiter() {
+	if os.Getenv("LOGIN_LIMITER_STORE") == "memory" {
+		loginAttempts = NewMemoryAttemptStore()
+		return
+	}
+	loginAttempts = MongoAttemptStore{Col: LoginAttemptsCol}
+}
+
+// MongoAttemptStore keeps one document per key. A TTL index on expiresAt
+// drops keys that have not failed for a while.
+type MongoAttemptStore struct {
+	Col *mongo.Collection
+}
+
+func (s MongoAttemptStore) Get(ctx context.Context, key string) (AttemptState, error) {
+	var state AttemptState
+	err := s.Col.FindOne(ctx, bson.M{"_id": key}).Decode(&state)
+	if err == mongo.ErrNoDocuments {
+		return AttemptState{}, nil
+	}
+	return state, err
+}
+
+func (s MongoAttemptStore) RecordFailure(ctx context.Context, key string, policy LoginLimitPolicy) (AttemptState, error) {
+	now := time.Now()
+	var state AttemptState
+	err := s.Col.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{"$inc": bson.M{"failures": 1}, "$set": bson.M{"expiresAt": now.Add(policy.Forget)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&state)
+	if err != nil {
+		return state, err
+	}
+
+	if d := policy.lockout(state.Failures); d > 0 {
+		state.LockedUntil = now.Add(d)
+		_, err = s.Col.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"lockedUntil": state.LockedUntil}})
+	}
+	return state, err
+}
+
+func (s MongoAttemptStore) Reset(ctx context.Context, key string) error {
+	_, err := s.Col.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// MemoryAttemptStore is an in-process attempt store.
+type MemoryAttemptStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryAttempt
+}
+
+type memoryAttempt struct {
+	state     AttemptState
+	expiresAt time.Time
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{entries: map[string]memoryAttempt{}}
+}
+
+func (s *MemoryAttemptStore) Get(ctx context.Context, key string) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		delete(s.entries, key)
+		return AttemptState{}, nil
+	}
+	return e.state, nil
+}
+
+func (s *MemoryAttemptStore) RecordFailure(ctx context.Context, key string, policy LoginLimitPolicy) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := s.entries[key]
+	if now.After(e.expiresAt) {
+		e = memoryAttempt{}
+	}
+	e.state.Failures++
+	e.expiresAt = now.Add(policy.Forget)
+	if d := policy.lockout(e.state.Failures); d > 0 {
+		e.state.LockedUntil = now.Add(d)
+	}
+	s.entries[key] = e
+
+	// Opportunistically drop stale keys so the map cannot grow forever.
+	if len(s.entries) > 10000 {
+		for k, v := range s.entries {
+			if now.After(v.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	return e.state, nil
+}
+
+func (s *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// clientIP returns the caller's address. X-Forwarded-For is only honoured
+// when TRUST_PROXY is set, since clients can forge it otherwise.
+func clientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY") == "true" {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginLimitKey is a key checked before an authentication attempt, with the
+// policy that applies to it.
+type loginLimitKey struct {
+	Key    string
+	Policy LoginLimitPolicy
+}
+
+func loginLimitKeys(r *http.Request, account string) []loginLimitKey {
+	return []loginLimitKey{
+		{Key: "account:" + strings.ToLower(account), Policy: emailLimitPolicy},
+		{Key: "ip:" + clientIP(r), Policy: ipLimitPolicy},
+	}
+}
+
+// loginLockedFor returns how long the caller still has to wait, or zero.
+func loginLockedFor(ctx context.Context, keys []loginLimitKey) time.Duration {
+	var wait time.Duration
+	for _, k := range keys {
+		state, err := loginAttempts.Get(ctx, k.Key)
+		if err != nil {
+			continue
+		}
+		if d := time.Until(state.LockedUntil); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// recordLoginFailure counts a failed attempt against every key and writes an
+// audit record for each key that becomes locked.
+func recordLoginFailure(ctx context.Context, r *http.Request, keys []loginLimitKey) {
+	for _, k := range keys {
+		state, err := loginAttempts.RecordFailure(ctx, k.Key, k.Policy)
+		if err != nil || state.LockedUntil.IsZero() || time.Until(state.LockedUntil) <= 0 {
+			continue
+		}
+		recordAudit(ctx, AuditEvent{
+			Event: "login_lockout",
+			IP:    clientIP(r),
+			Details: map[string]interface{}{
+				"key":         k.Key,
+				"failures":    state.Failures,
+				"lockedUntil": state.LockedUntil,
+			},
+		})
+	}
+}
+
+// resetLoginFailures clears the per-account counter after a successful login.
+// The per-IP counter is left alone so one valid account cannot be used to
+// reset it.
+func resetLoginFailures(ctx context.Context, keys []loginLimitKey) {
+	for _, k := range keys {
+		if strings.HasPrefix(k.Key, "ip:") {
+			continue
+		}
+		_ = loginAttempts.Reset(ctx, k.Key)
+	}
+}
+
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
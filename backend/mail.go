@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MailMessage is a plain-text email. Headers are added to the standard
+// ones, e.g. List-Unsubscribe.
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+	Headers map[string]string
+}
+
+// Mailer delivers transactional email (password resets, verification links).
+type Mailer interface {
+	Send(ctx context.Context, msg MailMessage) error
+}
+
+var mailer Mailer
+
+// InitMailer picks the mail sink from MAIL_SINK: "smtp", "file" or "log"
+// (the default, for local development).
+func InitMailer() {
+	switch os.Getenv("MAIL_SINK") {
+	case "smtp":
+		mailer = SMTPMailer{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     mailFrom(),
+		}
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		mailer = FileMailer{Dir: dir}
+	default:
+		mailer = LogMailer{}
+	}
+}
+
+func mailFrom() string {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@rizeos.local"
+	}
+	return from
+}
+
+// appURL returns the public URL of the frontend, used to build links in email.
+func appURL() string {
+	u := os.Getenv("APP_URL")
+	if u == "" {
+		u = "http://localhost:3000"
+	}
+	return strings.TrimRight(u, "/")
+}
+
+// validEmail accepts a bare address such as ada@example.com. Display names,
+// groups and line breaks are refused, since the address ends up in the To
+// header of the mail we send.
+func validEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Name == "" && addr.Address == s
+}
+
+// LogMailer writes messages to the server log instead of sending them.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg MailMessage) error {
+	log.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes each message to its own .eml file in Dir.
+type FileMailer struct {
+	Dir string
+}
+
+func (m FileMailer) Send(ctx context.Context, msg MailMessage) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(formatMessage(mailFrom(), msg)), 0o644)
+}
+
+// SMTPMailer sends through an SMTP relay using PLAIN auth.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m SMTPMailer) Send(ctx context.Context, msg MailMessage) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host := m.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, []byte(formatMessage(m.From, msg)))
+}
+
+func formatMessage(from string, msg MailMessage) string {
+	// Line breaks would let a value start headers of its own.
+	oneLine := strings.NewReplacer("\r", "", "\n", "").Replace
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", oneLine(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", oneLine(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, oneLine(msg.Headers[name]))
+	}
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	return b.String()
+}
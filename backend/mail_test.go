@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		ok    bool
+	}{
+		{"ada@example.com", true},
+		{"ada.lovelace+jobs@mail.example.co.uk", true},
+		{"", false},
+		{"ada", false},
+		{"ada@", false},
+		{"Ada <ada@example.com>", false},
+		{" ada@example.com", false},
+		{"ada@example.com\r\nBcc: eve@example.com", false},
+		{"ada@example.com, eve@example.com", false},
+	}
+	for _, tt := range tests {
+		if got := validEmail(tt.email); got != tt.ok {
+			t.Errorf("validEmail(%q) = %v, want %v", tt.email, got, tt.ok)
+		}
+	}
+}
+
+// Line breaks in any header value must not start new headers.
+func TestFormatMessageHeaderInjection(t *testing.T) {
+	msg := formatMessage("no-reply@example.com", MailMessage{
+		To:      "ada@example.com\r\nBcc: eve@example.com",
+		Subject: "Hello\nBcc: eve@example.com",
+		Headers: map[string]string{"List-Unsubscribe": "<https://example.com>\r\nBcc: eve@example.com"},
+		Body:    "Hi",
+	})
+	head, body, _ := strings.Cut(msg, "\r\n\r\n")
+	for _, line := range strings.Split(head, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") || strings.ContainsAny(line, "\r\n") {
+			t.Fatalf("injected header line %q in\n%s", line, head)
+		}
+	}
+	if body != "Hi" {
+		t.Fatalf("body = %q", body)
+	}
+}
@@ -10,10 +10,34 @@ import (
 )
 
 func main() {
+	if code, ok := runKeyCLI(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
 	// -----------------------
-	// Init DB
+	// Init keys & DB
 	// -----------------------
+	InitKeys()
 	InitDB()
+	InitSkills()
+	BackfillJobFilterFields()
+	MigrateJobStatus()
+	InitSearch()
+	MigrateSkills()
+	InitMailer()
+	InitAlerts()
+	InitLoginLimiter()
+	InitSiwe()
+	InitOIDC()
+
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
+	StartJobSweeper()
+	StartSkillRefresher()
+	StartAlertScheduler()
+	StartExportCleaner()
 
 	// Router
 	r := mux.NewRouter()
@@ -30,8 +54,9 @@ func main() {
 			}
 
 			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, If-Match")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Retry-After")
 
 			if req.Method == http.MethodOptions {
 				w.WriteHeader(http.StatusOK)
@@ -45,11 +70,10 @@ func main() {
 	// -----------------------
 	// API ROUTES
 	// -----------------------
-	api := r.PathPrefix("/api").Subrouter()
-	RegisterAuthRoutes(api)
-	RegisterProfileRoutes(api)
-	RegisterPaymentRoutes(api)
-	RegisterJobRoutes(api)
+	registerAPIRoutes(r)
+
+	// Public keys for verifying our tokens
+	r.HandleFunc("/.well-known/jwks.json", JWKSHandler).Methods("GET")
 
 	// -----------------------
 	// Serve React frontend
@@ -81,3 +105,29 @@ func main() {
 
 	log.Fatal(http.ListenAndServe(addr, r))
 }
+
+// registerAPIRoutes adds the /api routes. Each Register*Routes function uses
+// full paths, so they are added to the root router.
+func registerAPIRoutes(r *mux.Router) {
+	RegisterAuthRoutes(r)
+	RegisterSessionRoutes(r)
+	RegisterPasswordRoutes(r)
+	RegisterVerificationRoutes(r)
+	RegisterSiweRoutes(r)
+	RegisterTOTPRoutes(r)
+	RegisterOIDCRoutes(r)
+	RegisterAPIKeyRoutes(r)
+	RegisterAccountRoutes(r)
+	RegisterExportRoutes(r)
+	RegisterProfileRoutes(r)
+	RegisterPaymentRoutes(r)
+	// Before the job routes, so /api/jobs/recommended is not taken for a job id.
+	RegisterMatchingRoutes(r)
+	RegisterJobRoutes(r)
+	RegisterApplicationRoutes(r)
+	RegisterPipelineRoutes(r)
+	RegisterSkillRoutes(r)
+	RegisterSavedRoutes(r)
+	RegisterAlertRoutes(r)
+	RegisterAdminRoutes(r)
+}
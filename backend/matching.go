@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Skills a job lists first are taken to matter most: the first
+// coreSkillCount of them weigh coreSkillWeight, the rest 1.
+const (
+	coreSkillCount  = 3
+	coreSkillWeight = 2
+)
+
+// maxMatchPool bounds how many jobs or profiles are scored per request. The
+// most recent ones sharing a skill are taken.
+const maxMatchPool = 500
+
+// SkillMatch explains how well a candidate's skills cover a job's. Score is
+// the weighted share of the job's skills covered, from 0 to 100; Matched and
+// Missing are the job's skills as its poster wrote them.
+type SkillMatch struct {
+	Score   int      `json:"score"`
+	Matched []string `json:"matched"`
+	Missing []string `json:"missing"`
+	weight  float64
+}
+
+// matchSkills scores the candidate skill keys have against a job's skills.
+func matchSkills(jobSkills []string, have map[string]bool) SkillMatch {
+	m := SkillMatch{Matched: []string{}, Missing: []string{}}
+	seen := map[string]bool{}
+	var total float64
+	i := 0
+	for _, s := range jobSkills {
+		k := skillKey(s)
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		w := 1.0
+		if i < coreSkillCount {
+			w = coreSkillWeight
+		}
+		i++
+		total += w
+		if have[k] {
+			m.Matched = append(m.Matched, strings.TrimSpace(s))
+			m.weight += w
+		} else {
+			m.Missing = append(m.Missing, strings.TrimSpace(s))
+		}
+	}
+	if total > 0 {
+		m.Score = int(math.Round(100 * m.weight / total))
+	}
+	return m
+}
+
+func keySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+
+// matchPage reads ?limit= and the offset ?cursor= of a ranked listing.
+func matchPage(w http.ResponseWriter, r *http.Request) (limit, offset int, ok bool) {
+	q := r.URL.Query()
+	limit, err := pageSize(q)
+	if err == nil && q.Get("cursor") != "" {
+		offset, err = decodeOffsetCursor(q.Get("cursor"))
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return 0, 0, false
+	}
+	return limit, offset, true
+}
+
+type JobRecommendation struct {
+	Job Job `json:"job"`
+	SkillMatch
+}
+
+// RecommendedJobs ranks published jobs by how well the caller's profile
+// skills cover them. The GET /api/jobs filters apply as well. Jobs the
+// caller posted or already applied to are left out.
+func RecommendedJobs(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	limit, offset, ok := matchPage(w, r)
+	if !ok {
+		return
+	}
+	jf, err := parseJobFilter(r, r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	jf.Status = ""
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var profile Profile
+	if err := ProfilesCol.FindOne(ctx, bson.M{"userId": userID}).Decode(&profile); err != nil || len(profile.SkillKeys) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Add skills to your profile to get recommendations",
+			"code":  "profile_required",
+		})
+		return
+	}
+
+	applied, err := ApplicationsCol.Distinct(ctx, "jobId", bson.M{"candidateId": userID})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch recommendations"})
+		return
+	}
+	filter := bson.M{"$and": bson.A{
+		jf.bson(),
+		bson.M{"skillKeys": bson.M{"$in": profile.SkillKeys}},
+		bson.M{"postedBy": bson.M{"$ne": userID}},
+		bson.M{"_id": bson.M{"$nin": applied}},
+	}}
+	jobs, err := findAllFor[Job](ctx, JobsCol, filter, options.Find().SetSort(pageSort).SetLimit(maxMatchPool))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch recommendations"})
+		return
+	}
+
+	have := keySet(profile.SkillKeys)
+	recs := make([]JobRecommendation, len(jobs))
+	for i, job := range jobs {
+		job.Questions = publicQuestions(job.Questions)
+		recs[i] = JobRecommendation{Job: job, SkillMatch: matchSkills(job.Skills, have)}
+	}
+	// Ties go to the job with more matched weight, then the newer one; the
+	// pool is already newest first.
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].Score != recs[j].Score {
+			return recs[i].Score > recs[j].Score
+		}
+		return recs[i].weight > recs[j].weight
+	})
+
+	resp := struct {
+		Results    []JobRecommendation `json:"results"`
+		NextCursor string              `json:"nextCursor,omitempty"`
+	}{Results: []JobRecommendation{}}
+	if offset < len(recs) {
+		end := offset + limit
+		if end < len(recs) {
+			resp.NextCursor = encodeOffsetCursor(end)
+		} else {
+			end = len(recs)
+		}
+		resp.Results = recs[offset:end]
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+type CandidateMatch struct {
+	Profile Profile `json:"profile"`
+	// Applied tells whether the candidate has an active application to the
+	// job.
+	Applied bool `json:"applied"`
+	SkillMatch
+}
+
+// JobCandidates ranks candidate profiles by how well their skills cover a
+// job's. Only the job's poster and admins may see it.
+func JobCandidates(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := matchPage(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := findJob(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+		return
+	}
+	if !canManageJob(r, job) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Only the poster of this job can see matching candidates"})
+		return
+	}
+
+	resp := struct {
+		Results    []CandidateMatch `json:"results"`
+		NextCursor string           `json:"nextCursor,omitempty"`
+	}{Results: []CandidateMatch{}}
+	if len(job.SkillKeys) == 0 {
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	profiles, err := findAllFor[Profile](ctx, ProfilesCol,
+		bson.M{"skillKeys": bson.M{"$in": job.SkillKeys}, "userId": bson.M{"$ne": job.PostedBy}},
+		options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}}).SetLimit(maxMatchPool),
+	)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch candidates"})
+		return
+	}
+
+	// Employers and admins may have profiles too; only candidates are ranked.
+	ids := make([]primitive.ObjectID, 0, len(profiles))
+	for _, p := range profiles {
+		if oid, err := primitive.ObjectIDFromHex(p.UserID); err == nil {
+			ids = append(ids, oid)
+		}
+	}
+	users, err := findAllFor[User](ctx, UsersCol, bson.M{
+		"_id":  bson.M{"$in": ids},
+		"role": bson.M{"$nin": bson.A{RoleEmployer, RoleAdmin}},
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch candidates"})
+		return
+	}
+	isCandidate := map[string]bool{}
+	for _, u := range users {
+		isCandidate[u.ID.Hex()] = true
+	}
+	applied, err := ApplicationsCol.Distinct(ctx, "candidateId", bson.M{"jobId": job.ID, "status": ApplicationActive})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch candidates"})
+		return
+	}
+	hasApplied := map[string]bool{}
+	for _, id := range applied {
+		if s, ok := id.(string); ok {
+			hasApplied[s] = true
+		}
+	}
+
+	var matches []CandidateMatch
+	for _, p := range profiles {
+		if !isCandidate[p.UserID] {
+			continue
+		}
+		p.WalletAddress = ""
+		matches = append(matches, CandidateMatch{
+			Profile:    p,
+			Applied:    hasApplied[p.UserID],
+			SkillMatch: matchSkills(job.Skills, keySet(p.SkillKeys)),
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].weight > matches[j].weight
+	})
+
+	if offset < len(matches) {
+		end := offset + limit
+		if end < len(matches) {
+			resp.NextCursor = encodeOffsetCursor(end)
+		} else {
+			end = len(matches)
+		}
+		resp.Results = matches[offset:end]
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func RegisterMatchingRoutes(r *mux.Router) {
+	r.HandleFunc("/api/jobs/recommended", ScopedAuth(ScopeProfileRead)(RecommendedJobs)).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}/candidates", ScopedAuth(ScopeApplicationsRead)(RequireRole(RoleEmployer, RoleAdmin)(JobCandidates))).Methods("GET")
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMatchSkills(t *testing.T) {
+	withSkills(t, Skill{ID: primitive.NewObjectID(), Name: "Go", Key: "go", Aliases: []string{"golang"}})
+
+	tests := []struct {
+		name     string
+		job      []string
+		have     []string
+		score    int
+		matched  []string
+		missingN int
+	}{
+		// The first three skills weigh 2, so 2 + 1 of 2 + 2 + 2 + 1.
+		{"core and extra", []string{"Go", "React", "Docker", "AWS"}, []string{"go", "aws"}, 43, []string{"Go", "AWS"}, 2},
+		{"everything", []string{"Go", "React"}, []string{"go", "react", "rust"}, 100, []string{"Go", "React"}, 0},
+		{"nothing", []string{"Go", "React"}, []string{"rust"}, 0, []string{}, 2},
+		{"aliases count once", []string{" golang ", "Go", "SQL"}, []string{"go"}, 50, []string{"golang"}, 1},
+		{"no job skills", nil, []string{"go"}, 0, []string{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := matchSkills(tt.job, keySet(tt.have))
+			if m.Score != tt.score || fmt.Sprint(m.Matched) != fmt.Sprint(tt.matched) || len(m.Missing) != tt.missingN {
+				t.Fatalf("matchSkills = %+v, want score %d, matched %q, %d missing", m, tt.score, tt.matched, tt.missingN)
+			}
+			if m.Matched == nil || m.Missing == nil {
+				t.Fatal("Matched and Missing must encode as lists, not null")
+			}
+		})
+	}
+}
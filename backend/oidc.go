@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie binds a login attempt to the browser that started it. It
+// holds the hash of the state, so a callback URL carrying someone else's
+// code and state is refused.
+const oidcStateCookie = "oidc_state"
+
+// Identity links an account to a subject at an external OIDC provider.
+type Identity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"subject"`
+	Email    string    `bson:"email,omitempty" json:"email,omitempty"`
+	LinkedAt time.Time `bson:"linkedAt" json:"linkedAt"`
+}
+
+// OIDCProvider is a configured OpenID Connect identity provider. Endpoints
+// come from the issuer's discovery document and are fetched on first use.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	jwks      map[string]interface{}
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCState is the server side of one login attempt, keyed by the hash of
+// the state parameter.
+type OIDCState struct {
+	StateHash    string    `bson:"stateHash"`
+	Provider     string    `bson:"provider"`
+	Nonce        string    `bson:"nonce"`
+	CodeVerifier string    `bson:"codeVerifier"`
+	CreatedAt    time.Time `bson:"createdAt"`
+	ExpiresAt    time.Time `bson:"expiresAt"`
+}
+
+type oidcIDClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+var (
+	oidcProviders = map[string]*OIDCProvider{}
+	oidcClient    = &http.Client{Timeout: 10 * time.Second}
+)
+
+// InitOIDC reads providers from OIDC_PROVIDERS (comma-separated names) and,
+// for each NAME, OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _SCOPES
+// (space-separated, "openid email profile" by default) and _REDIRECT_URL.
+func InitOIDC() {
+	for _, name := range splitKeyList(os.Getenv("OIDC_PROVIDERS")) {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		p := &OIDCProvider{
+			Name:         strings.ToLower(name),
+			Issuer:       strings.TrimRight(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		}
+		if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			log.Printf("OIDC provider %s skipped: issuer, client id and redirect url are required", name)
+			continue
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{"openid", "email", "profile"}
+		}
+		oidcProviders[p.Name] = p
+	}
+}
+
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d oidcDiscovery
+	if err := getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if strings.TrimRight(d.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery: issuer mismatch %q", d.Issuer)
+	}
+	p.discovery = &d
+	return &d, nil
+}
+
+// verificationKey returns the provider key with the given kid, refreshing
+// the cached JWKS once when the kid is unknown (the provider rotated keys).
+func (p *OIDCProvider) verificationKey(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	key, ok := p.jwks[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []rawJWK `json:"keys"`
+	}
+	if err := getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+
+	p.mu.Lock()
+	p.jwks = keys
+	p.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown kid %q", kid)
+}
+
+// rawJWK is a JWK as published by an identity provider.
+type rawJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k rawJWK) publicKey() (interface{}, error) {
+	dec := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := dec(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := dec(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := dec(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := dec(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func getJSON(ctx context.Context, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// exchangeCode redeems an authorization code and returns the ID token.
+func (p *OIDCProvider) exchangeCode(ctx context.Context, code, verifier string) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return "", fmt.Errorf("token endpoint: %s %s", resp.Status, body.Error)
+	}
+	return body.IDToken, nil
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token.
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, raw, nonce string) (*oidcIDClaims, error) {
+	claims := &oidcIDClaims{}
+	token, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.verificationKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid id token: %v", err)
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return claims, nil
+}
+
+// secureCookies tells whether cookies should be limited to HTTPS: always in
+// production, and otherwise when the request came over TLS.
+func secureCookies(r *http.Request) bool {
+	return os.Getenv("APP_ENV") == "production" || r.TLS != nil
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// OIDCLogin starts the authorization code flow with PKCE by redirecting to
+// the provider.
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	p, ok := oidcProviders[mux.Vars(r)["provider"]]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unknown identity provider"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		log.Println("oidc:", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	state, stateHash, err1 := generateToken()
+	nonce, _, err2 := generateToken()
+	verifier, _, err3 := generateToken()
+	if err1 != nil || err2 != nil || err3 != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to start login"})
+		return
+	}
+
+	now := time.Now()
+	_, err = OIDCStatesCol.InsertOne(ctx, OIDCState{
+		StateHash:    stateHash,
+		Provider:     p.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(oidcStateTTL),
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to start login"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateHash,
+		Path:     "/api/oidc/" + p.Name,
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		// Lax still sends the cookie on the provider's top-level redirect
+		// back to the callback.
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", pkceChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, d.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// OIDCCallback finishes the flow: it redeems the code, verifies the ID token
+// and signs the matching account in. When OIDC_SUCCESS_REDIRECT is set the
+// result is handed to the frontend in the URL fragment, otherwise as JSON.
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	p, ok := oidcProviders[mux.Vars(r)["provider"]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unknown identity provider"})
+		return
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Identity provider returned an error: " + e})
+		return
+	}
+	if q.Get("code") == "" || q.Get("state") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Code and state are required"})
+		return
+	}
+
+	stateHash := hashToken(q.Get("state"))
+	cookie, err := r.Cookie(oidcStateCookie)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/oidc/" + p.Name,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash)) != 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Login was not started in this browser",
+			"code":  "oidc_state_mismatch",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var st OIDCState
+	err = OIDCStatesCol.FindOneAndDelete(ctx, bson.M{
+		"stateHash": stateHash,
+		"provider":  p.Name,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&st)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Login session is invalid or has expired"})
+		return
+	}
+
+	rawID, err := p.exchangeCode(ctx, q.Get("code"), st.CodeVerifier)
+	if err != nil {
+		log.Println("oidc:", err)
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to redeem authorization code"})
+		return
+	}
+
+	claims, err := p.verifyIDToken(ctx, rawID, st.Nonce)
+	if err != nil {
+		log.Println("oidc:", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid ID token"})
+		return
+	}
+
+	user, status, err := oidcUser(ctx, p.Name, claims)
+	if err != nil {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp, err := completeLogin(ctx, user, r.UserAgent())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create token"})
+		return
+	}
+
+	if target := os.Getenv("OIDC_SUCCESS_REDIRECT"); target != "" {
+		frag := url.Values{}
+		if resp.MFARequired {
+			frag.Set("mfaToken", resp.MFAToken)
+		} else {
+			frag.Set("token", resp.Token)
+			frag.Set("refreshToken", resp.RefreshToken)
+		}
+		http.Redirect(w, r, target+"#"+frag.Encode(), http.StatusFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// canLinkByEmail tells whether a new provider identity may be linked to the
+// local account with the same email. Both sides must have verified the
+// address: an unverified provider email could belong to anyone, and an
+// unverified local account may have been registered by someone else ahead of
+// the owner, who would keep its password and sessions after the link.
+func canLinkByEmail(user User, claims *oidcIDClaims) error {
+	if !claims.EmailVerified {
+		return errors.New("An account with this email already exists and the provider has not verified the email. Sign in with your password instead.")
+	}
+	if !user.Verified {
+		return errors.New("An account with this email already exists but its email is not verified. Verify it from the link we sent, then sign in with this provider again.")
+	}
+	return nil
+}
+
+// oidcUser finds the account for a verified ID token. Known identities sign
+// straight in; otherwise the identity is linked to the account with the same
+// email if canLinkByEmail allows it. Unknown users get a new account.
+func oidcUser(ctx context.Context, provider string, claims *oidcIDClaims) (User, int, error) {
+	var user User
+	err := UsersCol.FindOne(ctx, bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": claims.Subject}},
+	}).Decode(&user)
+	if err == nil {
+		return user, http.StatusOK, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, http.StatusInternalServerError, errors.New("Database error")
+	}
+
+	now := time.Now()
+	identity := Identity{Provider: provider, Subject: claims.Subject, Email: claims.Email, LinkedAt: now}
+
+	if claims.Email != "" {
+		err = UsersCol.FindOne(ctx, bson.M{"email": claims.Email}).Decode(&user)
+		if err == nil {
+			if err := canLinkByEmail(user, claims); err != nil {
+				return user, http.StatusConflict, err
+			}
+			if _, err := UsersCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$push": bson.M{"identities": identity}}); err != nil {
+				return user, http.StatusInternalServerError, errors.New("Failed to link account")
+			}
+			return user, http.StatusOK, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return user, http.StatusInternalServerError, errors.New("Database error")
+		}
+	}
+
+	user = User{
+		Role:       RoleCandidate,
+		CreatedAt:  now,
+		Identities: []Identity{identity},
+	}
+	if claims.Email != "" && claims.EmailVerified {
+		user.Email = claims.Email
+		user.Verified = true
+		user.VerifiedAt = &now
+	}
+	res, err := UsersCol.InsertOne(ctx, user)
+	if err != nil {
+		return user, http.StatusInternalServerError, errors.New("Failed to create user")
+	}
+	user.ID = res.InsertedID.(primitive.ObjectID)
+	return user, http.StatusCreated, nil
+}
+
+func RegisterOIDCRoutes(r *mux.Router) {
+	r.HandleFunc("/api/oidc/{provider}/login", OIDCLogin).Methods("GET")
+	r.HandleFunc("/api/oidc/{provider}/callback", OIDCCallback).Methods("GET")
+}
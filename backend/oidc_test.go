@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// fakeOIDC is an identity provider serving discovery, JWKS and the token
+// endpoint. Codes are registered with the PKCE challenge they were issued
+// for and the ID token claims to return.
+type fakeOIDC struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	kid string
+
+	mu    sync.Mutex
+	codes map[string]fakeCode
+}
+
+type fakeCode struct {
+	challenge string
+	claims    jwt.Claims
+}
+
+func newFakeOIDC(t *testing.T) *fakeOIDC {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeOIDC{key: key, kid: "test-key", codes: map[string]fakeCode{}}
+
+	m := http.NewServeMux()
+	m.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                f.URL,
+			AuthorizationEndpoint: f.URL + "/authorize",
+			TokenEndpoint:         f.URL + "/token",
+			JWKSURI:               f.URL + "/jwks",
+		})
+	})
+	m.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string][]rawJWK{"keys": {{
+			Kty: "RSA",
+			Kid: f.kid,
+			N:   enc(key.N.Bytes()),
+			E:   enc(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	m.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.mu.Lock()
+		c, ok := f.codes[r.PostForm.Get("code")]
+		delete(f.codes, r.PostForm.Get("code"))
+		f.mu.Unlock()
+		if !ok || pkceChallenge(r.PostForm.Get("code_verifier")) != c.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": f.sign(t, c.claims)})
+	})
+	f.Server = httptest.NewServer(m)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOIDC) sign(t *testing.T, claims jwt.Claims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = f.kid
+	raw, err := tok.SignedString(f.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func (f *fakeOIDC) issue(code, verifier string, claims jwt.Claims) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.codes[code] = fakeCode{challenge: pkceChallenge(verifier), claims: claims}
+}
+
+func (f *fakeOIDC) provider() *OIDCProvider {
+	return &OIDCProvider{
+		Name:        "fake",
+		Issuer:      f.URL,
+		ClientID:    "client-1",
+		RedirectURL: "http://localhost/api/oidc/fake/callback",
+	}
+}
+
+func (f *fakeOIDC) claims(nonce string) *oidcIDClaims {
+	now := time.Now()
+	return &oidcIDClaims{
+		Email:         "ada@example.com",
+		EmailVerified: true,
+		Nonce:         nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    f.URL,
+			Subject:   "subject-1",
+			Audience:  jwt.ClaimStrings{"client-1"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+func TestPKCEChallenge(t *testing.T) {
+	// RFC 7636, appendix B.
+	got := pkceChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Fatalf("pkceChallenge = %q, want %q", got, want)
+	}
+}
+
+func TestOIDCCodeExchange(t *testing.T) {
+	f := newFakeOIDC(t)
+	p := f.provider()
+	ctx := context.Background()
+
+	f.issue("code-1", "right-verifier", f.claims("nonce-1"))
+	if _, err := p.exchangeCode(ctx, "code-1", "wrong-verifier"); err == nil {
+		t.Fatal("code redeemed with the wrong PKCE verifier")
+	}
+
+	f.issue("code-2", "right-verifier", f.claims("nonce-1"))
+	raw, err := p.exchangeCode(ctx, "code-2", "right-verifier")
+	if err != nil {
+		t.Fatalf("exchangeCode: %v", err)
+	}
+	claims, err := p.verifyIDToken(ctx, raw, "nonce-1")
+	if err != nil {
+		t.Fatalf("verifyIDToken: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "ada@example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	if _, err := p.exchangeCode(ctx, "code-2", "right-verifier"); err == nil {
+		t.Fatal("code redeemed twice")
+	}
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	f := newFakeOIDC(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		nonce string
+		token func() string
+		ok    bool
+	}{
+		{"valid", "nonce-1", func() string { return f.sign(t, f.claims("nonce-1")) }, true},
+		{"nonce mismatch", "nonce-2", func() string { return f.sign(t, f.claims("nonce-1")) }, false},
+		{"empty nonce", "nonce-1", func() string { return f.sign(t, f.claims("")) }, false},
+		{"wrong audience", "nonce-1", func() string {
+			c := f.claims("nonce-1")
+			c.Audience = jwt.ClaimStrings{"someone-else"}
+			return f.sign(t, c)
+		}, false},
+		{"wrong issuer", "nonce-1", func() string {
+			c := f.claims("nonce-1")
+			c.Issuer = "https://evil.example.com"
+			return f.sign(t, c)
+		}, false},
+		{"expired", "nonce-1", func() string {
+			c := f.claims("nonce-1")
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			return f.sign(t, c)
+		}, false},
+		{"no subject", "nonce-1", func() string {
+			c := f.claims("nonce-1")
+			c.Subject = ""
+			return f.sign(t, c)
+		}, false},
+		{"signed by another key", "nonce-1", func() string {
+			tok := jwt.NewWithClaims(jwt.SigningMethodRS256, f.claims("nonce-1"))
+			tok.Header["kid"] = f.kid
+			raw, _ := tok.SignedString(other)
+			return raw
+		}, false},
+		{"unsigned", "nonce-1", func() string {
+			raw, _ := jwt.NewWithClaims(jwt.SigningMethodNone, f.claims("nonce-1")).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return raw
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.provider().verifyIDToken(context.Background(), tt.token(), tt.nonce)
+			if (err == nil) != tt.ok {
+				t.Fatalf("verifyIDToken error = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
+
+// The checks below run before the login state is looked up, so they need no
+// database.
+func TestOIDCCallbackRejects(t *testing.T) {
+	f := newFakeOIDC(t)
+	oidcProviders["fake"] = f.provider()
+	t.Cleanup(func() { delete(oidcProviders, "fake") })
+
+	tests := []struct {
+		name     string
+		provider string
+		query    string
+		status   int
+	}{
+		{"unknown provider", "nope", "code=c&state=s", http.StatusNotFound},
+		{"provider error", "fake", "error=access_denied&state=s", http.StatusUnauthorized},
+		{"missing state", "fake", "code=c", http.StatusBadRequest},
+		{"missing code", "fake", "state=s", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/oidc/"+tt.provider+"/callback?"+tt.query, nil)
+			r = mux.SetURLVars(r, map[string]string{"provider": tt.provider})
+			w := httptest.NewRecorder()
+			OIDCCallback(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.status, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+}
+
+// A callback must come from the browser that started the login: an
+// attacker's genuine code and state are refused without their cookie, and
+// the code is not redeemed.
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	f := newFakeOIDC(t)
+	oidcProviders["fake"] = f.provider()
+	t.Cleanup(func() { delete(oidcProviders, "fake") })
+
+	state, _, err := generateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherHash, err := generateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.issue("attacker-code", "verifier", f.claims("nonce"))
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"no cookie", nil},
+		{"cookie of another login", &http.Cookie{Name: oidcStateCookie, Value: otherHash}},
+		{"raw state as cookie", &http.Cookie{Name: oidcStateCookie, Value: state}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/oidc/fake/callback?code=attacker-code&state="+state, nil)
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			r = mux.SetURLVars(r, map[string]string{"provider": "fake"})
+			w := httptest.NewRecorder()
+			OIDCCallback(w, r)
+
+			var body map[string]string
+			json.NewDecoder(w.Body).Decode(&body)
+			if w.Code != http.StatusBadRequest || body["code"] != "oidc_state_mismatch" {
+				t.Fatalf("status = %d, body %v; want 400 oidc_state_mismatch", w.Code, body)
+			}
+			cleared := false
+			for _, c := range w.Result().Cookies() {
+				cleared = cleared || (c.Name == oidcStateCookie && c.MaxAge < 0)
+			}
+			if !cleared {
+				t.Fatal("state cookie was not cleared")
+			}
+		})
+	}
+
+	f.mu.Lock()
+	_, unused := f.codes["attacker-code"]
+	f.mu.Unlock()
+	if !unused {
+		t.Fatal("code was redeemed")
+	}
+}
+
+func TestCanLinkByEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		localVerified bool
+		idpVerified   bool
+		ok            bool
+	}{
+		{"both verified", true, true, true},
+		{"provider email unverified", true, false, false},
+		{"local account unverified", false, true, false},
+		{"neither verified", false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := User{Email: "ada@example.com", Verified: tt.localVerified}
+			claims := &oidcIDClaims{Email: "ada@example.com", EmailVerified: tt.idpVerified}
+			if err := canLinkByEmail(user, claims); (err == nil) != tt.ok {
+				t.Fatalf("canLinkByEmail error = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageCursor points just past the last item of a page ordered by
+// (createdAt, _id) descending. Clients treat it as opaque.
+type pageCursor struct {
+	CreatedAt int64  `json:"t"` // Unix milliseconds, the precision Mongo stores
+	ID        string `json:"id"`
+}
+
+func encodeCursor(createdAt time.Time, id primitive.ObjectID) string {
+	b, _ := json.Marshal(pageCursor{CreatedAt: createdAt.UnixMilli(), ID: id.Hex()})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// cursorFilter decodes a cursor into the filter selecting the items after it.
+func cursorFilter(cursor string) (bson.M, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	id, err := primitive.ObjectIDFromHex(c.ID)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	t := time.UnixMilli(c.CreatedAt)
+	return bson.M{"$or": bson.A{
+		bson.M{"createdAt": bson.M{"$lt": t}},
+		bson.M{"createdAt": t, "_id": bson.M{"$lt": id}},
+	}}, nil
+}
+
+// pageSize reads ?limit=, defaulting to 20 and capped at 100.
+func pageSize(q url.Values) (int, error) {
+	s := q.Get("limit")
+	if s == "" {
+		return defaultPageSize, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, errors.New("limit must be a positive number")
+	}
+	if n > maxPageSize {
+		n = maxPageSize
+	}
+	return n, nil
+}
+
+// pageSort is the order cursors are defined over.
+var pageSort = bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}
+
+// maxSearchOffset bounds how deep relevance-ranked results can be paged;
+// past it the search should be refined instead.
+const maxSearchOffset = 1000
+
+// offsetCursor pages results that have no stable sort key, such as
+// relevance-ranked search hits.
+type offsetCursor struct {
+	Offset int `json:"o"`
+}
+
+func encodeOffsetCursor(offset int) string {
+	b, _ := json.Marshal(offsetCursor{Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeOffsetCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	var c offsetCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	if c.Offset > maxSearchOffset {
+		return 0, errors.New("results this deep are not available; refine the search")
+	}
+	return c.Offset, nil
+}
+
+// pageParams reads ?limit= and ?cursor= for a (createdAt, _id) ordered
+// listing. after is nil on the first page.
+func pageParams(q url.Values) (limit int, after bson.M, err error) {
+	if limit, err = pageSize(q); err != nil {
+		return 0, nil, err
+	}
+	if c := q.Get("cursor"); c != "" {
+		if after, err = cursorFilter(c); err != nil {
+			return 0, nil, err
+		}
+	}
+	return limit, after, nil
+}
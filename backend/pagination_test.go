@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 30, 0, 123_456_789, time.UTC)
+	id := primitive.NewObjectID()
+
+	filter, err := cursorFilter(encodeCursor(createdAt, id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	or := filter["$or"].(bson.A)
+	before := or[0].(bson.M)["createdAt"].(bson.M)["$lt"].(time.Time)
+	same := or[1].(bson.M)
+	// Mongo keeps milliseconds, so the cursor does too.
+	if want := createdAt.Truncate(time.Millisecond); !before.Equal(want) || !same["createdAt"].(time.Time).Equal(want) {
+		t.Fatalf("cursor time = %v, want %v", before, want)
+	}
+	if got := same["_id"].(bson.M)["$lt"]; got != id {
+		t.Fatalf("cursor id = %v, want %v", got, id)
+	}
+}
+
+func TestCursorFilterRejects(t *testing.T) {
+	enc := base64.RawURLEncoding.EncodeToString
+	for _, c := range []string{
+		"not base64!",
+		enc([]byte("not json")),
+		enc([]byte(`{"t": 1714566600000, "id": "nope"}`)),
+		enc([]byte(`{"t": 1714566600000}`)),
+	} {
+		if _, err := cursorFilter(c); err == nil {
+			t.Errorf("cursorFilter(%q) accepted", c)
+		}
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	tests := []struct {
+		limit string
+		want  int
+		ok    bool
+	}{
+		{"", defaultPageSize, true},
+		{"5", 5, true},
+		{"1000", maxPageSize, true},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"ten", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := pageSize(url.Values{"limit": {tt.limit}})
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("pageSize(%q) = %d, %v; want %d, ok=%v", tt.limit, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestOffsetCursor(t *testing.T) {
+	for _, offset := range []int{0, 20, maxSearchOffset} {
+		got, err := decodeOffsetCursor(encodeOffsetCursor(offset))
+		if err != nil || got != offset {
+			t.Errorf("offset %d round-tripped to %d, %v", offset, got, err)
+		}
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString
+	for _, c := range []string{
+		"not base64!",
+		enc([]byte("not json")),
+		enc([]byte(`{"o": -1}`)),
+		encodeOffsetCursor(maxSearchOffset + 1),
+	} {
+		if _, err := decodeOffsetCursor(c); err == nil {
+			t.Errorf("decodeOffsetCursor(%q) accepted", c)
+		}
+	}
+}
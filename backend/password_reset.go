@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const passwordResetTTL = time.Hour
+
+// Reset requests are counted with the login attempt store. Every request
+// counts, so the thresholds are in requests rather than failures: three per
+// address and ten per IP before the lockouts start.
+var (
+	resetEmailPolicy = LoginLimitPolicy{FreeAttempts: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, Forget: time.Hour}
+	resetIPPolicy    = LoginLimitPolicy{FreeAttempts: 9, BaseLockout: time.Minute, MaxLockout: time.Hour, Forget: time.Hour}
+)
+
+// PasswordReset is a single-use reset token. Only its hash is stored.
+type PasswordReset struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    string             `bson:"userId" json:"userId"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty" json:"usedAt,omitempty"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ForgotPassword emails a reset link. It answers the same way whether or not
+// the address is registered so it cannot be used to enumerate accounts.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Email is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The address is throttled whether or not it is registered, so the
+	// throttle gives nothing away either.
+	keys := []loginLimitKey{
+		{Key: "reset:account:" + strings.ToLower(req.Email), Policy: resetEmailPolicy},
+		{Key: "reset:ip:" + clientIP(r), Policy: resetIPPolicy},
+	}
+	if wait := loginLockedFor(ctx, keys); wait > 0 {
+		setRetryAfter(w, wait)
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Too many reset requests. Please try again later.", "code": "reset_throttled"})
+		return
+	}
+	for _, k := range keys {
+		if _, err := loginAttempts.RecordFailure(ctx, k.Key, k.Policy); err != nil {
+			log.Println("password reset: throttle:", err)
+		}
+	}
+
+	var user User
+	err := UsersCol.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+		return
+	}
+
+	if err == nil {
+		if err := sendPasswordReset(ctx, user); err != nil {
+			log.Println("password reset:", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the email is registered, a reset link has been sent"})
+}
+
+func sendPasswordReset(ctx context.Context, user User) error {
+	raw, hash, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reset := PasswordReset{
+		UserID:    user.ID.Hex(),
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(passwordResetTTL),
+	}
+
+	// Only the most recent link stays valid.
+	_, _ = PasswordResetsCol.DeleteMany(ctx, bson.M{"userId": reset.UserID, "usedAt": bson.M{"$exists": false}})
+	if _, err := PasswordResetsCol.InsertOne(ctx, reset); err != nil {
+		return err
+	}
+
+	return mailer.Send(ctx, MailMessage{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your account.\n\n"+
+			"Use this link within an hour to choose a new password:\n%s/reset-password?token=%s\n\n"+
+			"If it wasn't you, you can ignore this email.\n", appURL(), raw),
+	})
+}
+
+// ResetPassword consumes a reset token, stores the new password and revokes
+// every existing session of the account.
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if req.Token == "" || req.Password == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Token and password are required"})
+		return
+	}
+
+	if len(req.Password) < 6 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Password must be at least 6 characters"})
+		return
+	}
+
+	hashed, err := hashPassword(req.Password)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to hash password"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Mark the token used in the same operation that finds it so it can only
+	// ever be redeemed once.
+	now := time.Now()
+	var reset PasswordReset
+	err = PasswordResetsCol.FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": hashToken(req.Token),
+			"usedAt":    bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&reset)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Reset link is invalid or has expired"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+		return
+	}
+
+	oid, _ := primitive.ObjectIDFromHex(reset.UserID)
+	_, err = UsersCol.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": bson.M{"password": hashed}})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update password"})
+		return
+	}
+
+	if err := revokeAllSessions(ctx, reset.UserID); err != nil {
+		log.Println("password reset: revoke sessions:", err)
+	}
+	if err := revokeAllAPIKeys(ctx, reset.UserID); err != nil {
+		log.Println("password reset: revoke api keys:", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset"})
+}
+
+func RegisterPasswordRoutes(r *mux.Router) {
+	r.HandleFunc("/api/password/forgot", ForgotPassword).Methods("POST")
+	r.HandleFunc("/api/password/reset", ResetPassword).Methods("POST")
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Stages every pipeline has. New applications start in StageApplied; hired
+// and rejected are where candidates end up.
+const (
+	StageApplied  = "applied"
+	StageHired    = "hired"
+	StageRejected = "rejected"
+)
+
+// decidedStages are the stages where the employer has made a decision the
+// candidate cannot undo by withdrawing or applying again.
+var decidedStages = bson.A{StageHired, StageRejected}
+
+// defaultPipeline is used by jobs that have not configured their own.
+var defaultPipeline = []string{StageApplied, "screening", "interview", "offer", StageHired, StageRejected}
+
+const (
+	maxPipelineStages = 12
+	maxNoteLength     = 2000
+)
+
+var stageName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,29}$`)
+
+// Timeline event types.
+const (
+	EventApplied      = "applied"
+	EventReopened     = "reopened"
+	EventWithdrawn    = "withdrawn"
+	EventStageChanged = "stage_changed"
+	EventNote         = "note"
+)
+
+// ApplicationEvent is one entry of an application's activity timeline.
+// Notes and who made a change are for the employer only.
+type ApplicationEvent struct {
+	Type string    `bson:"type" json:"type"`
+	From string    `bson:"from,omitempty" json:"from,omitempty"`
+	To   string    `bson:"to,omitempty" json:"to,omitempty"`
+	Note string    `bson:"note,omitempty" json:"note,omitempty"`
+	By   string    `bson:"by,omitempty" json:"by,omitempty"`
+	At   time.Time `bson:"at" json:"at"`
+}
+
+// jobPipeline returns the stages of a job's pipeline in order.
+func jobPipeline(job Job) []string {
+	if len(job.Pipeline) == 0 {
+		return defaultPipeline
+	}
+	return job.Pipeline
+}
+
+// validatePipeline checks a custom pipeline: unique lower-case stage names,
+// starting with applied and including hired and rejected.
+func validatePipeline(stages []string) error {
+	if len(stages) > maxPipelineStages {
+		return errors.New("a pipeline can have at most 12 stages")
+	}
+	if len(stages) == 0 || stages[0] != StageApplied {
+		return errors.New("a pipeline must start with applied")
+	}
+	seen := map[string]bool{}
+	for _, s := range stages {
+		if !stageName.MatchString(s) {
+			return errors.New("stage names must be lower-case letters, digits, - or _")
+		}
+		if seen[s] {
+			return errors.New("stage " + s + " is listed twice")
+		}
+		seen[s] = true
+	}
+	if !seen[StageHired] || !seen[StageRejected] {
+		return errors.New("a pipeline must include hired and rejected")
+	}
+	return nil
+}
+
+func hasStage(job Job, stage string) bool {
+	for _, s := range jobPipeline(job) {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// applicationStage returns the stage of an application; ones stored before
+// pipelines existed are still applied.
+func applicationStage(app Application) string {
+	if app.Stage == "" {
+		return StageApplied
+	}
+	return app.Stage
+}
+
+// forCandidate hides the employer's notes, who acted, and the knockout
+// flags from the candidate's view of an application.
+func (app Application) forCandidate() Application {
+	events := make([]ApplicationEvent, 0, len(app.Timeline))
+	for _, e := range app.Timeline {
+		if e.Type == EventNote {
+			continue
+		}
+		e.Note, e.By = "", ""
+		events = append(events, e)
+	}
+	app.Timeline = events
+	app.KnockedOut, app.Knockouts = false, nil
+	return app
+}
+
+type StageRequest struct {
+	Stage string `json:"stage"`
+	Note  string `json:"note"`
+}
+
+// MoveApplication moves an active application to another stage of its
+// job's pipeline, recording the move (and an optional note) on the
+// timeline. Only the job's poster and admins may do this.
+func MoveApplication(w http.ResponseWriter, r *http.Request) {
+	var req StageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > maxNoteLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Notes can be at most 2000 characters"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	app, job, ok := findApplication(ctx, r, mux.Vars(r)["id"])
+	if !ok || !canManageJob(r, job) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Application not found"})
+		return
+	}
+	if app.Status != ApplicationActive {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The candidate has withdrawn this application"})
+		return
+	}
+	if !hasStage(job, req.Stage) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  "stage must be one of the job's pipeline stages",
+			"stages": jobPipeline(job),
+		})
+		return
+	}
+	from := applicationStage(app)
+	if req.Stage == from {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The application is already in " + from})
+		return
+	}
+
+	userID, _ := r.Context().Value("userId").(string)
+	now := time.Now()
+	event := ApplicationEvent{Type: EventStageChanged, From: from, To: req.Stage, Note: req.Note, By: userID, At: now}
+
+	// Matching on the stage we read keeps two reviewers from both moving
+	// the same candidate.
+	stageFilter := bson.M{"_id": app.ID, "status": ApplicationActive, "stage": app.Stage}
+	if app.Stage == "" {
+		stageFilter["stage"] = bson.M{"$exists": false}
+	}
+
+	var updated Application
+	err := ApplicationsCol.FindOneAndUpdate(ctx,
+		stageFilter,
+		bson.M{
+			"$set":  bson.M{"stage": req.Stage, "stageChangedAt": now, "updatedAt": now},
+			"$push": bson.M{"timeline": event},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The application was changed by someone else. Reload it and try again."})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to move application"})
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+// AddApplicationNote adds an employer note to an application's timeline.
+func AddApplicationNote(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if req.Note == "" || len(req.Note) > maxNoteLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "note must be between 1 and 2000 characters"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	app, job, ok := findApplication(ctx, r, mux.Vars(r)["id"])
+	if !ok || !canManageJob(r, job) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Application not found"})
+		return
+	}
+
+	userID, _ := r.Context().Value("userId").(string)
+	now := time.Now()
+	var updated Application
+	err := ApplicationsCol.FindOneAndUpdate(ctx,
+		bson.M{"_id": app.ID},
+		bson.M{
+			"$set":  bson.M{"updatedAt": now},
+			"$push": bson.M{"timeline": ApplicationEvent{Type: EventNote, Note: req.Note, By: userID, At: now}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to add note"})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// StageCount is the number of active applications in one stage.
+type StageCount struct {
+	Stage string `json:"stage"`
+	Count int    `json:"count"`
+}
+
+// stageCounts counts a job's active applications per stage, in pipeline
+// order, plus the withdrawn ones.
+func stageCounts(ctx context.Context, job Job) ([]StageCount, int, error) {
+	cur, err := ApplicationsCol.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"jobId": job.ID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"status": "$status",
+				"stage":  bson.M{"$ifNull": bson.A{"$stage", StageApplied}},
+			},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+
+	var groups []struct {
+		ID struct {
+			Status string `bson:"status"`
+			Stage  string `bson:"stage"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err := cur.All(ctx, &groups); err != nil {
+		return nil, 0, err
+	}
+
+	active := map[string]int{}
+	withdrawn := 0
+	for _, g := range groups {
+		if g.ID.Status == ApplicationWithdrawn {
+			withdrawn += g.Count
+			continue
+		}
+		active[g.ID.Stage] += g.Count
+	}
+
+	counts := []StageCount{}
+	for _, s := range jobPipeline(job) {
+		counts = append(counts, StageCount{Stage: s, Count: active[s]})
+		delete(active, s)
+	}
+	// Stages dropped from the pipeline while applications were in them.
+	for s, n := range active {
+		counts = append(counts, StageCount{Stage: s, Count: n})
+	}
+	return counts, withdrawn, nil
+}
+
+// GetPipeline returns a job's pipeline with the number of applications in
+// each stage.
+func GetPipeline(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := findJob(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+		return
+	}
+	if !canManageJob(r, job) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Only the poster of this job can see its pipeline"})
+		return
+	}
+
+	counts, withdrawn, err := stageCounts(ctx, job)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to count applications"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stages":    counts,
+		"withdrawn": withdrawn,
+	})
+}
+
+// SetPipeline replaces a job's pipeline stages. A stage that still holds
+// active applications cannot be removed. Like UpdateJob it needs the version
+// the client last saw (If-Match or "version").
+func SetPipeline(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Stages  []string `json:"stages"`
+		Version *int     `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if err := validatePipeline(req.Stages); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	version, ok := expectedVersion(r, req.Version)
+	if !ok {
+		w.WriteHeader(http.StatusPreconditionRequired)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Send the job version in If-Match or the version field"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := findJob(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+		return
+	}
+	if !canManageJob(r, job) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Only the poster of this job can change its pipeline"})
+		return
+	}
+
+	keep := map[string]bool{}
+	for _, s := range req.Stages {
+		keep[s] = true
+	}
+	occupied, err := occupiedStage(ctx, job, keep)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to count applications"})
+		return
+	}
+	if occupied != nil {
+		writeOccupiedStage(w, *occupied)
+		return
+	}
+
+	var updated Job
+	err = JobsCol.FindOneAndUpdate(ctx,
+		versionFilter(job.ID, version),
+		bson.M{"$set": bson.M{"pipeline": req.Stages, "updatedAt": time.Now()}, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			w.Header().Set("ETag", jobETag(job))
+			w.WriteHeader(http.StatusPreconditionFailed)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":   "The job was changed by someone else. Reload it and try again.",
+				"code":    "version_conflict",
+				"version": job.Version,
+			})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update pipeline"})
+		return
+	}
+
+	// An application may have been moved into a removed stage between the
+	// count and the update. Count again and put the old stages back if so.
+	occupied, err = occupiedStage(ctx, updated, keep)
+	if err != nil || occupied != nil {
+		set := bson.M{"updatedAt": time.Now()}
+		restore := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+		if len(job.Pipeline) == 0 {
+			restore["$unset"] = bson.M{"pipeline": ""}
+		} else {
+			set["pipeline"] = job.Pipeline
+		}
+		if _, rerr := JobsCol.UpdateOne(ctx, versionFilter(updated.ID, updated.Version), restore); rerr != nil {
+			log.Println("pipeline rollback:", rerr)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to count applications"})
+			return
+		}
+		writeOccupiedStage(w, *occupied)
+		return
+	}
+
+	w.Header().Set("ETag", jobETag(updated))
+	json.NewEncoder(w).Encode(map[string]interface{}{"stages": jobPipeline(updated)})
+}
+
+// occupiedStage returns a stage of job outside keep that still holds active
+// applications, or nil.
+func occupiedStage(ctx context.Context, job Job, keep map[string]bool) (*StageCount, error) {
+	counts, _, err := stageCounts(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		if c.Count > 0 && !keep[c.Stage] {
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func writeOccupiedStage(w http.ResponseWriter, c StageCount) {
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": "Move the applications out of " + c.Stage + " before removing it",
+		"stage": c.Stage,
+		"count": c.Count,
+	})
+}
+
+func RegisterPipelineRoutes(r *mux.Router) {
+	r.HandleFunc("/api/jobs/{id}/pipeline", ScopedAuth(ScopeApplicationsRead)(GetPipeline)).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}/pipeline", ScopedAuth(ScopeJobsWrite)(SetPipeline)).Methods("PUT")
+	r.HandleFunc("/api/applications/{id}/stage", ScopedAuth(ScopeApplicationsWrite)(MoveApplication)).Methods("POST")
+	r.HandleFunc("/api/applications/{id}/notes", ScopedAuth(ScopeApplicationsWrite)(AddApplicationNote)).Methods("POST")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestValidatePipeline(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []string
+		ok     bool
+	}{
+		{"default", defaultPipeline, true},
+		{"minimal", []string{"applied", "hired", "rejected"}, true},
+		{"custom stages", []string{"applied", "phone_screen", "take-home", "hired", "rejected"}, true},
+		{"empty", nil, false},
+		{"not starting with applied", []string{"screening", "applied", "hired", "rejected"}, false},
+		{"missing hired", []string{"applied", "rejected"}, false},
+		{"missing rejected", []string{"applied", "hired"}, false},
+		{"duplicate", []string{"applied", "offer", "offer", "hired", "rejected"}, false},
+		{"upper case", []string{"applied", "Offer", "hired", "rejected"}, false},
+		{"spaces", []string{"applied", "on site", "hired", "rejected"}, false},
+		{"too many", append([]string{"applied", "hired", "rejected"}, strings.Split("a,b,c,d,e,f,g,h,i,j", ",")...), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePipeline(tt.stages); (err == nil) != tt.ok {
+				t.Fatalf("validatePipeline error = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
+
+// A pipeline change without the job version is refused before the job is
+// loaded, like a job update.
+func TestSetPipelineRequiresVersion(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/api/jobs/64b7f0c2a1b2c3d4e5f60718/pipeline",
+		strings.NewReader(`{"stages": ["applied", "hired", "rejected"]}`))
+	r = mux.SetURLVars(withCaller(r, "employer-1", RoleEmployer), map[string]string{"id": "64b7f0c2a1b2c3d4e5f60718"})
+	w := httptest.NewRecorder()
+	SetPipeline(w, r)
+	if w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("status = %d, want 428 (%s)", w.Code, strings.TrimSpace(w.Body.String()))
+	}
+}
@@ -22,14 +22,15 @@ type Profile struct {
 	Skills        []string           `bson:"skills" json:"skills"`
 	WalletAddress string             `bson:"walletAddress" json:"walletAddress"`
 	UpdatedAt     time.Time          `bson:"updatedAt" json:"updatedAt"`
+	// SkillKeys are the canonical forms of Skills, used for matching.
+	SkillKeys []string `bson:"skillKeys,omitempty" json:"-"`
 }
 
 type ProfileUpdateRequest struct {
-	Name          string   `json:"name"`
-	Bio           string   `json:"bio"`
-	LinkedInURL   string   `json:"linkedInUrl"`
-	Skills        []string `json:"skills"`
-	WalletAddress string   `json:"walletAddress"`
+	Name        string   `json:"name"`
+	Bio         string   `json:"bio"`
+	LinkedInURL string   `json:"linkedInUrl"`
+	Skills      []string `json:"skills"`
 }
 
 func GetProfile(w http.ResponseWriter, r *http.Request) {
@@ -78,16 +79,17 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	skills := normalizeSkills(req.Skills)
 	now := time.Now()
 	update := bson.M{
 		"$set": bson.M{
-			"userId":        userID,
-			"name":          req.Name,
-			"bio":           req.Bio,
-			"linkedInUrl":   req.LinkedInURL,
-			"skills":        req.Skills,
-			"walletAddress": req.WalletAddress,
-			"updatedAt":    now,
+			"userId":      userID,
+			"name":        req.Name,
+			"bio":         req.Bio,
+			"linkedInUrl": req.LinkedInURL,
+			"skills":      skills,
+			"skillKeys":   skillKeys(skills),
+			"updatedAt":   now,
 		},
 	}
 
@@ -105,6 +107,6 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request) {
 }
 
 func RegisterProfileRoutes(r *mux.Router) {
-	r.HandleFunc("/api/profile", JWTMiddleware(GetProfile)).Methods("GET")
-	r.HandleFunc("/api/profile", JWTMiddleware(UpdateProfile)).Methods("PUT", "POST")
+	r.HandleFunc("/api/profile", ScopedAuth(ScopeProfileRead)(GetProfile)).Methods("GET")
+	r.HandleFunc("/api/profile", ScopedAuth(ScopeProfileWrite)(UpdateProfile)).Methods("PUT", "POST")
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	RoleCandidate = "candidate"
+	RoleEmployer  = "employer"
+	RoleAdmin     = "admin"
+)
+
+type UpdateRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func validRole(role string) bool {
+	return role == RoleCandidate || role == RoleEmployer || role == RoleAdmin
+}
+
+// userRole returns the user's role; accounts created before roles existed are
+// candidates.
+func userRole(user User) string {
+	if user.Role == "" {
+		return RoleCandidate
+	}
+	return user.Role
+}
+
+// RequireRole only lets requests through whose user has one of the given
+// roles. It must be wrapped by JWTMiddleware, which puts the role in the
+// request context:
+//
+//	JWTMiddleware(RequireRole(RoleEmployer, RoleAdmin)(CreateJob))
+func RequireRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value("userRole").(string)
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "You do not have permission to perform this action",
+				"code":  "insufficient_role",
+			})
+		}
+	}
+}
+
+// ListUsers returns all accounts, newest first. Admin only.
+func ListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cur, err := UsersCol.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch users"})
+		return
+	}
+	defer cur.Close(ctx)
+
+	var users []User
+	if err := cur.All(ctx, &users); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to decode users"})
+		return
+	}
+
+	if users == nil {
+		users = []User{}
+	}
+	for i := range users {
+		users[i].Role = userRole(users[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// UpdateUserRole changes the role of an account. Admin only.
+func UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	callerID, _ := r.Context().Value("userId").(string)
+
+	oid, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user id"})
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if !validRole(req.Role) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Role must be candidate, employer or admin"})
+		return
+	}
+
+	if oid.Hex() == callerID && req.Role != RoleAdmin {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Admins cannot remove their own admin role"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := UsersCol.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": bson.M{"role": req.Role}})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update role"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role updated"})
+}
+
+func RegisterAdminRoutes(r *mux.Router) {
+	admin := RequireRole(RoleAdmin)
+	r.HandleFunc("/api/admin/users", JWTMiddleware(admin(ListUsers))).Methods("GET")
+	r.HandleFunc("/api/admin/users/{id}/role", JWTMiddleware(admin(UpdateUserRole))).Methods("PUT")
+}
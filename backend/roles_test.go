@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// withCaller returns r carrying the identity JWTMiddleware would put in the
+// request context.
+func withCaller(r *http.Request, userID, role string) *http.Request {
+	ctx := context.WithValue(r.Context(), "userId", userID)
+	if role != "" {
+		ctx = context.WithValue(ctx, "userRole", role)
+	}
+	return r.WithContext(ctx)
+}
+
+// TestRequireRole drives the routes through the router main builds, with
+// real access tokens, so a route losing its guard is caught. Requests the
+// guard lets through reach handlers without a database; those panics are
+// recovered and count as allowed.
+func TestRequireRole(t *testing.T) {
+	kr, err := loadKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKeyring, oldLoad := keyring, loadSessionUser
+	keyring = kr
+	t.Cleanup(func() { keyring, loadSessionUser = oldKeyring, oldLoad })
+
+	users := map[string]User{}
+	tokens := map[string]string{}
+	for _, role := range []string{RoleCandidate, RoleEmployer, RoleAdmin} {
+		user := User{ID: primitive.NewObjectID(), Email: role + "@example.com", Role: role}
+		token, err := signAccessToken(user, "session-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[user.ID.Hex()] = user
+		tokens[role] = token
+	}
+	loadSessionUser = func(ctx context.Context, userID string) (User, error) {
+		user, ok := users[userID]
+		if !ok {
+			return user, mongo.ErrNoDocuments
+		}
+		return user, nil
+	}
+
+	router := mux.NewRouter()
+	registerAPIRoutes(router)
+
+	const job = "/api/jobs/64b7f0c2a1b2c3d4e5f60718"
+	const user = "/api/admin/users/64b7f0c2a1b2c3d4e5f60719"
+	employers := []string{RoleEmployer, RoleAdmin}
+	admins := []string{RoleAdmin}
+	routes := []struct {
+		method  string
+		path    string
+		allowed []string
+	}{
+		{http.MethodPost, "/api/jobs", employers},
+		{http.MethodPost, job + "/applications", []string{RoleCandidate}},
+		{http.MethodGet, job + "/applications", employers},
+		{http.MethodGet, job + "/candidates", employers},
+		{http.MethodGet, "/api/me/bookmarks", employers},
+		{http.MethodPut, "/api/me/bookmarks/64b7f0c2a1b2c3d4e5f60719", employers},
+		{http.MethodDelete, "/api/me/bookmarks/64b7f0c2a1b2c3d4e5f60719", employers},
+		{http.MethodGet, "/api/admin/users", admins},
+		{http.MethodPut, user + "/role", admins},
+		{http.MethodGet, "/api/admin/skills", admins},
+		{http.MethodPost, "/api/admin/skills", admins},
+		{http.MethodPut, "/api/admin/skills/64b7f0c2a1b2c3d4e5f60720", admins},
+	}
+	for _, rt := range routes {
+		for _, role := range []string{RoleCandidate, RoleEmployer, RoleAdmin} {
+			allowed := slices.Contains(rt.allowed, role)
+			t.Run(rt.method+" "+rt.path+" as "+role, func(t *testing.T) {
+				r := httptest.NewRequest(rt.method, rt.path, strings.NewReader("{}"))
+				r.Header.Set("Authorization", "Bearer "+tokens[role])
+				w := httptest.NewRecorder()
+				func() {
+					defer func() { recover() }()
+					router.ServeHTTP(w, r)
+				}()
+
+				var body map[string]string
+				json.NewDecoder(w.Body).Decode(&body)
+				refused := w.Code == http.StatusForbidden && body["code"] == "insufficient_role"
+				if w.Code == http.StatusUnauthorized || refused == allowed {
+					t.Fatalf("status = %d, code %q; allowed = %v", w.Code, body["code"], allowed)
+				}
+			})
+		}
+	}
+}
+
+// Applicants, the pipeline and matching candidates of a job are only shown
+// to its poster and to admins.
+func TestCanManageJob(t *testing.T) {
+	job := Job{PostedBy: "employer-1"}
+	tests := []struct {
+		name   string
+		userID string
+		role   string
+		want   bool
+	}{
+		{"poster", "employer-1", RoleEmployer, true},
+		{"other employer", "employer-2", RoleEmployer, false},
+		{"admin", "admin-1", RoleAdmin, true},
+		{"candidate", "candidate-1", RoleCandidate, false},
+		{"anonymous", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := withCaller(httptest.NewRequest(http.MethodGet, "/api/jobs/1/applications", nil), tt.userID, tt.role)
+			if got := canManageJob(r, job); got != tt.want {
+				t.Fatalf("canManageJob = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// These requests are refused before the database is touched.
+func TestUpdateUserRoleValidation(t *testing.T) {
+	const adminID = "64b7f0c2a1b2c3d4e5f60718"
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		want   int
+	}{
+		{"invalid user id", "nope", `{"role":"employer"}`, http.StatusBadRequest},
+		{"unknown role", "64b7f0c2a1b2c3d4e5f60719", `{"role":"owner"}`, http.StatusBadRequest},
+		{"admin demoting themselves", adminID, `{"role":"employer"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/api/admin/users/"+tt.target+"/role", strings.NewReader(tt.body))
+			r = mux.SetURLVars(withCaller(r, adminID, RoleAdmin), map[string]string{"id": tt.target})
+			w := httptest.NewRecorder()
+			UpdateUserRole(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.want, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Pay periods of a Compensation.
+const (
+	PeriodHourly  = "hourly"
+	PeriodMonthly = "monthly"
+	PeriodYearly  = "yearly"
+)
+
+// Working hours and months in a year, used to annualize pay.
+const (
+	hoursPerYear  = 2080 // 40 hours a week, 52 weeks
+	monthsPerYear = 12
+)
+
+// Compensation is the pay offered for a job. Min and Max are amounts per
+// Period in Currency (ISO 4217). Text is the original free-form salary when
+// the value was parsed from one; "Negotiable" gives a Compensation with
+// only Text.
+type Compensation struct {
+	Min      float64 `bson:"min" json:"min"`
+	Max      float64 `bson:"max" json:"max"`
+	Currency string  `bson:"currency,omitempty" json:"currency,omitempty"`
+	Period   string  `bson:"period,omitempty" json:"period,omitempty"`
+	Equity   bool    `bson:"equity" json:"equity"`
+	Text     string  `bson:"text,omitempty" json:"text,omitempty"`
+}
+
+// compensationFields has Compensation's fields without its decoders, so they
+// can fall back to the default decoding.
+type compensationFields Compensation
+
+// UnmarshalJSON accepts the structured object or, from older clients, a
+// free-form string such as "$50k - $70k / year".
+func (c *Compensation) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = parseSalary(s)
+		return nil
+	}
+	if err := json.Unmarshal(data, (*compensationFields)(c)); err != nil {
+		return err
+	}
+	c.Currency = strings.ToUpper(strings.TrimSpace(c.Currency))
+	return nil
+}
+
+// UnmarshalBSONValue reads jobs stored before salaries were structured,
+// whose salary is still a string.
+func (c *Compensation) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.String:
+		s, _, ok := bsoncore.ReadString(data)
+		if !ok {
+			return errors.New("salary: malformed string")
+		}
+		*c = parseSalary(s)
+		return nil
+	case bsontype.Null, bsontype.Undefined:
+		*c = Compensation{}
+		return nil
+	case bsontype.EmbeddedDocument:
+		return bson.Unmarshal(data, (*compensationFields)(c))
+	}
+	return fmt.Errorf("salary: cannot decode %s", t)
+}
+
+// hasAmount reports whether c has numbers to compare, as opposed to only a
+// legacy text.
+func (c Compensation) hasAmount() bool {
+	return c.Max > 0
+}
+
+// validate checks a salary sent by a client. A text-only value is accepted
+// so that older clients can keep posting things like "Negotiable".
+func (c Compensation) validate() error {
+	if !c.hasAmount() && c.Min == 0 {
+		if strings.TrimSpace(c.Text) == "" && (c.Currency != "" || c.Period != "") {
+			return errors.New("salary needs a max amount")
+		}
+		return nil
+	}
+	if c.Min < 0 || c.Max <= 0 {
+		return errors.New("salary amounts must be positive")
+	}
+	if c.Max < c.Min {
+		return errors.New("salary max cannot be less than min")
+	}
+	// Salaries sent as text may not name a currency; structured ones must.
+	if !validCurrency(c.Currency) && !(c.Currency == "" && c.Text != "") {
+		return errors.New("salary currency must be an ISO 4217 code such as USD")
+	}
+	switch c.Period {
+	case PeriodHourly, PeriodMonthly, PeriodYearly:
+	default:
+		return errors.New("salary period must be hourly, monthly or yearly")
+	}
+	return nil
+}
+
+// annualize converts an amount per c.Period to an amount per year.
+func (c Compensation) annualize(amount float64) float64 {
+	switch c.Period {
+	case PeriodHourly:
+		return amount * hoursPerYear
+	case PeriodMonthly:
+		return amount * monthsPerYear
+	}
+	return amount
+}
+
+// annualRange is the yearly pay range used to compare salaries of different
+// periods. It is nil when there is nothing to compare.
+func (c *Compensation) annualRange() (min, max *float64) {
+	if c == nil || !c.hasAmount() {
+		return nil, nil
+	}
+	lo, hi := c.annualize(c.Min), c.annualize(c.Max)
+	return &lo, &hi
+}
+
+// iso4217 lists the active ISO 4217 currency codes.
+var iso4217 = func() map[string]bool {
+	codes := map[string]bool{}
+	for _, c := range strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND
+		BOB BRL BSD BTN BWP BYN BZD CAD CDF CHF CLP CNY COP CRC CUP CVE CZK DJF
+		DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GNF GTQ GYD HKD
+		HNL HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW
+		KWD KYD KZT LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR
+		MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR NZD OMR PAB PEN PGK PHP PKR PLN
+		PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN
+		SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS UAH UGX USD UYU UZS VES
+		VND VUV WST XAF XCD XCG XOF XPF YER ZAR ZMW ZWG`) {
+		codes[c] = true
+	}
+	return codes
+}()
+
+func validCurrency(code string) bool {
+	return iso4217[code]
+}
+
+var currencySymbols = []struct{ symbol, code string }{
+	{"US$", "USD"}, {"C$", "CAD"}, {"A$", "AUD"}, {"$", "USD"},
+	{"€", "EUR"}, {"£", "GBP"}, {"₹", "INR"}, {"¥", "JPY"}, {"₩", "KRW"},
+	{"₦", "NGN"}, {"₱", "PHP"}, {"Rs.", "INR"},
+}
+
+var (
+	salaryNumber  = regexp.MustCompile(`(?i)(\d[\d,]*(?:\.\d+)?)\s*(k|m|lpa|lakhs?)?\b`)
+	currencyWord  = regexp.MustCompile(`\b[A-Z]{3}\b`)
+	hourlyWords   = regexp.MustCompile(`(?i)(/\s*(h|hr|hour)\b|\bper\s+hour\b|\bhourly\b|\ban\s+hour\b)`)
+	monthlyWords  = regexp.MustCompile(`(?i)(/\s*(m|mo|mon|month)\b|\bper\s+month\b|\bmonthly\b|\bpm\b|\ba\s+month\b)`)
+	lakhsPerAnnum = regexp.MustCompile(`(?i)\b(lpa|lakhs?)\b`)
+)
+
+var salaryUnits = map[string]float64{"k": 1_000, "m": 1_000_000, "lpa": 100_000, "lakh": 100_000, "lakhs": 100_000}
+
+// parseSalary understands the free-form salaries stored before they were
+// structured, e.g. "$50k - $70k", "€4,000/month", "₹10-12 LPA" or
+// "Negotiable", and keeps the original as Text. Without a period, yearly is
+// assumed; the currency stays empty when the text does not name one.
+func parseSalary(s string) Compensation {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Compensation{}
+	}
+	c := Compensation{Text: s}
+
+	var nums []float64
+	var units []float64
+	for _, m := range salaryNumber.FindAllStringSubmatch(s, 2) {
+		n, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64)
+		if err != nil {
+			continue
+		}
+		unit := salaryUnits[strings.ToLower(m[2])]
+		if unit == 0 {
+			unit = 1
+		}
+		nums = append(nums, n)
+		units = append(units, unit)
+	}
+	// In "50-70k" or "10-12 LPA" the unit is written after the range only.
+	if len(nums) == 2 && units[0] == 1 {
+		units[0] = units[1]
+	}
+	switch len(nums) {
+	case 0:
+		return c
+	case 1:
+		c.Min, c.Max = nums[0]*units[0], nums[0]*units[0]
+	default:
+		c.Min, c.Max = nums[0]*units[0], nums[1]*units[1]
+		if c.Min > c.Max {
+			c.Min, c.Max = c.Max, c.Min
+		}
+	}
+
+	for _, cs := range currencySymbols {
+		if strings.Contains(s, cs.symbol) {
+			c.Currency = cs.code
+			break
+		}
+	}
+	for _, w := range currencyWord.FindAllString(s, -1) {
+		if validCurrency(w) {
+			c.Currency = w
+			break
+		}
+	}
+	if lakhsPerAnnum.MatchString(s) && c.Currency == "" {
+		c.Currency = "INR"
+	}
+
+	switch {
+	case hourlyWords.MatchString(s):
+		c.Period = PeriodHourly
+	case monthlyWords.MatchString(s):
+		c.Period = PeriodMonthly
+	default:
+		c.Period = PeriodYearly
+	}
+	c.Equity = strings.Contains(strings.ToLower(s), "equity")
+	return c
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSalary(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Compensation
+	}{
+		{"$50k - $70k", Compensation{Min: 50000, Max: 70000, Currency: "USD", Period: PeriodYearly}},
+		{"€4,000/month", Compensation{Min: 4000, Max: 4000, Currency: "EUR", Period: PeriodMonthly}},
+		{"₹10-12 LPA", Compensation{Min: 1_000_000, Max: 1_200_000, Currency: "INR", Period: PeriodYearly}},
+		{"25 USD per hour", Compensation{Min: 25, Max: 25, Currency: "USD", Period: PeriodHourly}},
+		{"80k-60k + equity", Compensation{Min: 60000, Max: 80000, Period: PeriodYearly, Equity: true}},
+		{"Negotiable", Compensation{}},
+		{"  ", Compensation{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			want := tt.want
+			if s := strings.TrimSpace(tt.in); s != "" {
+				want.Text = s
+			}
+			if got := parseSalary(tt.in); got != want {
+				t.Fatalf("parseSalary(%q) = %+v, want %+v", tt.in, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxBookmarkNote = 500
+
+// SavedJob is a job on a user's shortlist. (userId, jobId) is unique.
+type SavedJob struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    string             `bson:"userId" json:"userId"`
+	JobID     primitive.ObjectID `bson:"jobId" json:"jobId"`
+	CreatedAt time.Time          `bson:"createdAt" json:"savedAt"`
+}
+
+// Bookmark is a candidate an employer keeps an eye on, with a private note.
+// (employerId, candidateId) is unique.
+type Bookmark struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	EmployerID  string             `bson:"employerId" json:"employerId"`
+	CandidateID string             `bson:"candidateId" json:"candidateId"`
+	Note        string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// pageOf returns one page of col matching filter, newest first, and the
+// cursor of the next page.
+func pageOf[T any](ctx context.Context, col *mongo.Collection, filter bson.M, limit int, after bson.M, cursor func(T) string) ([]T, string, error) {
+	if after != nil {
+		filter = bson.M{"$and": bson.A{filter, after}}
+	}
+	items, err := findAllFor[T](ctx, col, filter, options.Find().SetSort(pageSort).SetLimit(int64(limit+1)))
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(items) > limit {
+		items = items[:limit]
+		next = cursor(items[limit-1])
+	}
+	return items, next, nil
+}
+
+// SaveJob adds a job to the caller's saved jobs. Saving it again is a
+// no-op. Only jobs the caller can see can be saved.
+func SaveJob(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := findJob(ctx, mux.Vars(r)["jobId"])
+	if err != nil || (job.Status != StatusPublished && !canManageJob(r, job)) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+		return
+	}
+
+	res, err := SavedJobsCol.UpdateOne(ctx,
+		bson.M{"userId": userID, "jobId": job.ID},
+		bson.M{"$setOnInsert": bson.M{"createdAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	// Two concurrent saves can both try the insert; the loser finds the
+	// winner's document.
+	if mongo.IsDuplicateKeyError(err) {
+		err = nil
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to save job"})
+		return
+	}
+	if res != nil && res.UpsertedCount > 0 {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Job saved"})
+}
+
+// UnsaveJob removes a job from the caller's saved jobs.
+func UnsaveJob(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	oid, err := primitive.ObjectIDFromHex(mux.Vars(r)["jobId"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Saved job not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := SavedJobsCol.DeleteOne(ctx, bson.M{"userId": userID, "jobId": oid})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to remove saved job"})
+		return
+	}
+	if res.DeletedCount == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Saved job not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSavedJobs lists the caller's saved jobs, most recently saved first,
+// each with the job as it is now. Jobs deleted since are left out.
+func ListSavedJobs(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	limit, after, err := pageParams(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	saved, next, err := pageOf(ctx, SavedJobsCol, bson.M{"userId": userID}, limit, after, func(s SavedJob) string {
+		return encodeCursor(s.CreatedAt, s.ID)
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch saved jobs"})
+		return
+	}
+
+	ids := make([]primitive.ObjectID, len(saved))
+	for i, s := range saved {
+		ids[i] = s.JobID
+	}
+	found, err := findAllFor[Job](ctx, JobsCol, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch saved jobs"})
+		return
+	}
+	jobs := map[primitive.ObjectID]Job{}
+	for _, j := range found {
+		jobs[j.ID] = j
+	}
+
+	type item struct {
+		JobID   primitive.ObjectID `json:"jobId"`
+		SavedAt time.Time          `json:"savedAt"`
+		Job     Job                `json:"job"`
+	}
+	manages := jobViewer(r)
+	items := []item{}
+	for _, s := range saved {
+		job, ok := jobs[s.JobID]
+		if !ok {
+			continue
+		}
+		if !manages(job) {
+			job.Questions = publicQuestions(job.Questions)
+		}
+		items = append(items, item{JobID: s.JobID, SavedAt: s.CreatedAt, Job: job})
+	}
+
+	resp := map[string]interface{}{"savedJobs": items}
+	if next != "" {
+		resp["nextCursor"] = next
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+type BookmarkRequest struct {
+	Note string `json:"note"`
+}
+
+// BookmarkCandidate bookmarks a candidate for the calling employer, or
+// updates the note of an existing bookmark.
+func BookmarkCandidate(w http.ResponseWriter, r *http.Request) {
+	employerID, _ := r.Context().Value("userId").(string)
+	candidateID := mux.Vars(r)["candidateId"]
+
+	// The body, and with it the note, is optional.
+	var req BookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > maxBookmarkNote {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "note can be at most 500 characters"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Only candidates with a profile can be bookmarked.
+	user, err := findUserByID(ctx, candidateID)
+	if err != nil || userRole(user) != RoleCandidate {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Candidate not found"})
+		return
+	}
+	if err := ProfilesCol.FindOne(ctx, bson.M{"userId": candidateID}).Err(); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Candidate not found"})
+		return
+	}
+
+	now := time.Now()
+	filter := bson.M{"employerId": employerID, "candidateId": candidateID}
+	res, err := BookmarksCol.UpdateOne(ctx, filter,
+		bson.M{
+			"$set":         bson.M{"note": req.Note, "updatedAt": now},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	var bookmark Bookmark
+	if err == nil {
+		err = BookmarksCol.FindOne(ctx, filter).Decode(&bookmark)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to bookmark candidate"})
+		return
+	}
+	if res.UpsertedCount > 0 {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(bookmark)
+}
+
+// RemoveBookmark deletes the calling employer's bookmark of a candidate.
+func RemoveBookmark(w http.ResponseWriter, r *http.Request) {
+	employerID, _ := r.Context().Value("userId").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := BookmarksCol.DeleteOne(ctx, bson.M{"employerId": employerID, "candidateId": mux.Vars(r)["candidateId"]})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to remove bookmark"})
+		return
+	}
+	if res.DeletedCount == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Bookmark not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListBookmarks lists the calling employer's bookmarked candidates, newest
+// first, with each candidate's current profile.
+func ListBookmarks(w http.ResponseWriter, r *http.Request) {
+	employerID, _ := r.Context().Value("userId").(string)
+
+	limit, after, err := pageParams(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bookmarks, next, err := pageOf(ctx, BookmarksCol, bson.M{"employerId": employerID}, limit, after, func(b Bookmark) string {
+		return encodeCursor(b.CreatedAt, b.ID)
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch bookmarks"})
+		return
+	}
+
+	candidates := make([]string, len(bookmarks))
+	for i, b := range bookmarks {
+		candidates[i] = b.CandidateID
+	}
+	found, err := findAllFor[Profile](ctx, ProfilesCol, bson.M{"userId": bson.M{"$in": candidates}})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch bookmarks"})
+		return
+	}
+	profiles := map[string]Profile{}
+	for _, p := range found {
+		p.WalletAddress = ""
+		profiles[p.UserID] = p
+	}
+
+	type item struct {
+		Bookmark
+		Profile *Profile `json:"profile,omitempty"`
+	}
+	items := make([]item, len(bookmarks))
+	for i, b := range bookmarks {
+		items[i] = item{Bookmark: b}
+		if p, ok := profiles[b.CandidateID]; ok {
+			items[i].Profile = &p
+		}
+	}
+
+	resp := map[string]interface{}{"bookmarks": items}
+	if next != "" {
+		resp["nextCursor"] = next
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func RegisterSavedRoutes(r *mux.Router) {
+	employer := RequireRole(RoleEmployer, RoleAdmin)
+	r.HandleFunc("/api/me/saved-jobs", ScopedAuth(ScopeSavedRead)(ListSavedJobs)).Methods("GET")
+	r.HandleFunc("/api/me/saved-jobs/{jobId}", ScopedAuth(ScopeSavedWrite)(SaveJob)).Methods("PUT")
+	r.HandleFunc("/api/me/saved-jobs/{jobId}", ScopedAuth(ScopeSavedWrite)(UnsaveJob)).Methods("DELETE")
+	r.HandleFunc("/api/me/bookmarks", ScopedAuth(ScopeSavedRead)(employer(ListBookmarks))).Methods("GET")
+	r.HandleFunc("/api/me/bookmarks/{candidateId}", ScopedAuth(ScopeSavedWrite)(employer(BookmarkCandidate))).Methods("PUT")
+	r.HandleFunc("/api/me/bookmarks/{candidateId}", ScopedAuth(ScopeSavedWrite)(employer(RemoveBookmark))).Methods("DELETE")
+}
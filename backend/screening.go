@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Screening question types.
+const (
+	QuestionYesNo          = "yes_no"
+	QuestionMultipleChoice = "multiple_choice"
+	QuestionNumeric        = "numeric"
+	QuestionText           = "text"
+)
+
+const (
+	maxQuestions          = 20
+	maxPromptLength       = 300
+	maxChoices            = 20
+	maxChoiceLength       = 100
+	defaultTextAnswerSize = 1000
+	maxTextAnswerSize     = 5000
+)
+
+// Question is a screening question on a job. Answers that match Knockout
+// flag the applicant; they are still accepted.
+type Question struct {
+	ID       string   `bson:"id" json:"id"`
+	Type     string   `bson:"type" json:"type"`
+	Prompt   string   `bson:"prompt" json:"prompt"`
+	Required bool     `bson:"required" json:"required"`
+	Choices  []string `bson:"choices,omitempty" json:"choices,omitempty"`
+	// Min and Max bound numeric answers; MaxLength bounds text answers.
+	Min       *float64  `bson:"min,omitempty" json:"min,omitempty"`
+	Max       *float64  `bson:"max,omitempty" json:"max,omitempty"`
+	MaxLength int       `bson:"maxLength,omitempty" json:"maxLength,omitempty"`
+	Knockout  *Knockout `bson:"knockout,omitempty" json:"knockout,omitempty"`
+}
+
+// Knockout describes disqualifying answers: for yes/no questions "yes" or
+// "no", for multiple choice any of the listed choices, and for numeric
+// questions a value below Below or above Above.
+type Knockout struct {
+	Answers []string `bson:"answers,omitempty" json:"answers,omitempty"`
+	Below   *float64 `bson:"below,omitempty" json:"below,omitempty"`
+	Above   *float64 `bson:"above,omitempty" json:"above,omitempty"`
+}
+
+// Answer is a candidate's answer to a screening question. The prompt is
+// copied so the answer still reads well if the question is edited later.
+type Answer struct {
+	QuestionID string   `bson:"questionId" json:"questionId"`
+	Prompt     string   `bson:"prompt" json:"prompt"`
+	Bool       *bool    `bson:"bool,omitempty" json:"bool,omitempty"`
+	Choice     string   `bson:"choice,omitempty" json:"choice,omitempty"`
+	Number     *float64 `bson:"number,omitempty" json:"number,omitempty"`
+	Text       string   `bson:"text,omitempty" json:"text,omitempty"`
+}
+
+// AnswerInput is an answer as sent by the candidate. Value is a boolean,
+// one of the choices, a number or a string depending on the question.
+type AnswerInput struct {
+	QuestionID string          `json:"questionId"`
+	Value      json.RawMessage `json:"value"`
+}
+
+// validateQuestions checks an employer's screening questions and gives the
+// ones without an id one.
+func validateQuestions(questions []Question) error {
+	if len(questions) > maxQuestions {
+		return fmt.Errorf("a job can have at most %d screening questions", maxQuestions)
+	}
+	ids := map[string]bool{}
+	for _, q := range questions {
+		if q.ID == "" {
+			continue
+		}
+		if ids[q.ID] {
+			return fmt.Errorf("question id %s is used twice", q.ID)
+		}
+		if len(q.ID) > 40 {
+			return fmt.Errorf("question id %s is too long", q.ID)
+		}
+		ids[q.ID] = true
+	}
+	next := 1
+	for i := range questions {
+		q := &questions[i]
+		q.Prompt = strings.TrimSpace(q.Prompt)
+		for q.ID == "" {
+			if id := fmt.Sprintf("q%d", next); !ids[id] {
+				q.ID = id
+				ids[id] = true
+			}
+			next++
+		}
+		if q.Prompt == "" || len(q.Prompt) > maxPromptLength {
+			return fmt.Errorf("question %s: prompt must be between 1 and %d characters", q.ID, maxPromptLength)
+		}
+
+		k := q.Knockout
+		switch q.Type {
+		case QuestionYesNo:
+			if k != nil {
+				for _, a := range k.Answers {
+					if a != "yes" && a != "no" {
+						return fmt.Errorf("question %s: knockout answers must be yes or no", q.ID)
+					}
+				}
+			}
+		case QuestionMultipleChoice:
+			if len(q.Choices) < 2 || len(q.Choices) > maxChoices {
+				return fmt.Errorf("question %s: needs between 2 and %d choices", q.ID, maxChoices)
+			}
+			seen := map[string]bool{}
+			for _, c := range q.Choices {
+				if c == "" || len(c) > maxChoiceLength || seen[c] {
+					return fmt.Errorf("question %s: choices must be distinct and 1 to %d characters", q.ID, maxChoiceLength)
+				}
+				seen[c] = true
+			}
+			if k != nil {
+				for _, a := range k.Answers {
+					if !seen[a] {
+						return fmt.Errorf("question %s: knockout answer %q is not a choice", q.ID, a)
+					}
+				}
+			}
+		case QuestionNumeric:
+			if q.Min != nil && q.Max != nil && *q.Min > *q.Max {
+				return fmt.Errorf("question %s: min cannot be greater than max", q.ID)
+			}
+		case QuestionText:
+			if k != nil {
+				return fmt.Errorf("question %s: text questions cannot have knockout answers", q.ID)
+			}
+			if q.MaxLength == 0 {
+				q.MaxLength = defaultTextAnswerSize
+			}
+			if q.MaxLength < 0 || q.MaxLength > maxTextAnswerSize {
+				return fmt.Errorf("question %s: maxLength can be at most %d", q.ID, maxTextAnswerSize)
+			}
+		default:
+			return fmt.Errorf("question %s: type must be yes_no, multiple_choice, numeric or text", q.ID)
+		}
+
+		if k != nil && q.Type != QuestionNumeric && (k.Below != nil || k.Above != nil) {
+			return fmt.Errorf("question %s: only numeric questions can knock out below or above a value", q.ID)
+		}
+		if k != nil && q.Type == QuestionNumeric && len(k.Answers) > 0 {
+			return fmt.Errorf("question %s: numeric knockouts use below and above", q.ID)
+		}
+	}
+	return nil
+}
+
+// AnswerErrors maps question ids to what is wrong with their answer.
+type AnswerErrors map[string]string
+
+func (e AnswerErrors) Error() string {
+	return "some screening answers are missing or invalid"
+}
+
+// checkAnswers validates answers against a job's questions. It returns the
+// answers to store and the ids of the questions whose knockout they hit.
+func checkAnswers(questions []Question, inputs []AnswerInput) ([]Answer, []string, error) {
+	byID := map[string]Question{}
+	for _, q := range questions {
+		byID[q.ID] = q
+	}
+
+	problems := AnswerErrors{}
+	given := map[string]AnswerInput{}
+	for _, in := range inputs {
+		if _, ok := byID[in.QuestionID]; !ok {
+			problems[in.QuestionID] = "no such question"
+			continue
+		}
+		if _, dup := given[in.QuestionID]; dup {
+			problems[in.QuestionID] = "answered twice"
+			continue
+		}
+		if v := strings.TrimSpace(string(in.Value)); v == "" || v == "null" {
+			continue
+		}
+		given[in.QuestionID] = in
+	}
+
+	var answers []Answer
+	var knockouts []string
+	for _, q := range questions {
+		in, ok := given[q.ID]
+		if !ok {
+			if q.Required {
+				problems[q.ID] = "required"
+			}
+			continue
+		}
+		a, err := parseAnswer(q, in.Value)
+		if err != nil {
+			problems[q.ID] = err.Error()
+			continue
+		}
+		answers = append(answers, a)
+		if knockedOut(q, a) {
+			knockouts = append(knockouts, q.ID)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, nil, problems
+	}
+	return answers, knockouts, nil
+}
+
+func parseAnswer(q Question, raw json.RawMessage) (Answer, error) {
+	a := Answer{QuestionID: q.ID, Prompt: q.Prompt}
+	switch q.Type {
+	case QuestionYesNo:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return a, errors.New("must be true or false")
+		}
+		a.Bool = &b
+	case QuestionMultipleChoice:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return a, errors.New("must be one of the choices")
+		}
+		for _, c := range q.Choices {
+			if c == s {
+				a.Choice = s
+				return a, nil
+			}
+		}
+		return a, errors.New("must be one of the choices")
+	case QuestionNumeric:
+		var n float64
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return a, errors.New("must be a number")
+		}
+		if (q.Min != nil && n < *q.Min) || (q.Max != nil && n > *q.Max) {
+			return a, errors.New("is out of range")
+		}
+		a.Number = &n
+	case QuestionText:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return a, errors.New("must be text")
+		}
+		s = strings.TrimSpace(s)
+		if s == "" && q.Required {
+			return a, errors.New("required")
+		}
+		if len(s) > q.MaxLength {
+			return a, fmt.Errorf("can be at most %d characters", q.MaxLength)
+		}
+		a.Text = s
+	}
+	return a, nil
+}
+
+func knockedOut(q Question, a Answer) bool {
+	k := q.Knockout
+	if k == nil {
+		return false
+	}
+	switch q.Type {
+	case QuestionYesNo:
+		answer := "no"
+		if *a.Bool {
+			answer = "yes"
+		}
+		for _, ko := range k.Answers {
+			if ko == answer {
+				return true
+			}
+		}
+	case QuestionMultipleChoice:
+		for _, ko := range k.Answers {
+			if ko == a.Choice {
+				return true
+			}
+		}
+	case QuestionNumeric:
+		return (k.Below != nil && *a.Number < *k.Below) || (k.Above != nil && *a.Number > *k.Above)
+	}
+	return false
+}
+
+// publicQuestions hides the knockout answers from candidates, who could
+// otherwise tailor their answers to pass.
+func publicQuestions(questions []Question) []Question {
+	out := make([]Question, len(questions))
+	for i, q := range questions {
+		q.Knockout = nil
+		out[i] = q
+	}
+	return out
+}
+
+// jobViewer reports, for the caller of a public endpoint, whether they
+// manage a given job and so may see its knockout answers.
+func jobViewer(r *http.Request) func(Job) bool {
+	user, ok := optionalUser(r)
+	return func(job Job) bool {
+		return ok && (job.PostedBy == user.ID.Hex() || userRole(user) == RoleAdmin)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCheckAnswers(t *testing.T) {
+	two, ten := 2.0, 10.0
+	questions := []Question{
+		{ID: "visa", Type: QuestionYesNo, Prompt: "Do you need a visa?", Required: true, Knockout: &Knockout{Answers: []string{"yes"}}},
+		{ID: "level", Type: QuestionMultipleChoice, Prompt: "Level?", Choices: []string{"junior", "senior"}, Knockout: &Knockout{Answers: []string{"junior"}}},
+		{ID: "years", Type: QuestionNumeric, Prompt: "Years of Go?", Max: &ten, Knockout: &Knockout{Below: &two}},
+		{ID: "why", Type: QuestionText, Prompt: "Why us?", MaxLength: 10},
+	}
+	answers := func(pairs ...string) []AnswerInput {
+		var in []AnswerInput
+		for i := 0; i < len(pairs); i += 2 {
+			in = append(in, AnswerInput{QuestionID: pairs[i], Value: json.RawMessage(pairs[i+1])})
+		}
+		return in
+	}
+
+	tests := []struct {
+		name      string
+		inputs    []AnswerInput
+		stored    int
+		knockouts []string
+		problems  AnswerErrors
+	}{
+		{"all answered", answers("visa", "false", "level", `"senior"`, "years", "5", "why", `" Go! "`), 4, nil, nil},
+		{"optional left out", answers("visa", "false"), 1, nil, nil},
+		{"null counts as unanswered", answers("visa", "false", "years", "null"), 1, nil, nil},
+		{"knocked out", answers("visa", "true", "level", `"junior"`, "years", "1"), 3, []string{"visa", "level", "years"}, nil},
+		{"required missing", answers("level", `"senior"`), 0, nil, AnswerErrors{"visa": "required"}},
+		{"unknown question", answers("visa", "false", "salary", "100"), 0, nil, AnswerErrors{"salary": "no such question"}},
+		{"answered twice", answers("visa", "false", "visa", "true"), 0, nil, AnswerErrors{"visa": "answered twice"}},
+		{"wrong types", answers("visa", `"no"`, "level", `"lead"`, "years", `"five"`, "why", "3"), 0, nil, AnswerErrors{
+			"visa": "must be true or false", "level": "must be one of the choices", "years": "must be a number", "why": "must be text",
+		}},
+		{"out of range", answers("visa", "false", "years", "11"), 0, nil, AnswerErrors{"years": "is out of range"}},
+		{"text too long", answers("visa", "false", "why", `"far too long"`), 0, nil, AnswerErrors{"why": "can be at most 10 characters"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, knockouts, err := checkAnswers(questions, tt.inputs)
+			if tt.problems != nil {
+				var problems AnswerErrors
+				if !errors.As(err, &problems) || fmt.Sprint(problems) != fmt.Sprint(tt.problems) {
+					t.Fatalf("error = %v, want %v", err, tt.problems)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if len(got) != tt.stored || fmt.Sprint(knockouts) != fmt.Sprint(tt.knockouts) {
+				t.Fatalf("%d answers, knockouts %v; want %d, %v", len(got), knockouts, tt.stored, tt.knockouts)
+			}
+		})
+	}
+}
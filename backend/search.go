@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Relative importance of a match in each field. The Mongo text index is
+// created with the same weights.
+var searchWeights = map[string]float64{
+	"title":       10,
+	"description": 4,
+	"skills":      2,
+}
+
+const maxSearchLength = 200
+
+// SearchQuery is a full-text query over published jobs. Filter narrows the
+// hits the same way it narrows GET /api/jobs.
+type SearchQuery struct {
+	Text   string
+	Filter JobFilter
+	Offset int
+	Limit  int
+}
+
+// SearchHit is one ranked result. Highlights holds HTML-escaped excerpts of
+// the matching fields with the matched words wrapped in <mark>.
+type SearchHit struct {
+	Job        Job               `json:"job"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// JobSearcher indexes published jobs and answers ranked searches over them.
+// The Mongo searcher uses a text index and suits any deployment; the memory
+// searcher keeps its own inverted index and is enough for a single node.
+type JobSearcher interface {
+	// Index adds or replaces a job. Jobs that are not published are removed
+	// instead.
+	Index(ctx context.Context, job Job) error
+	Remove(ctx context.Context, id primitive.ObjectID) error
+	// Search returns the hits in [Offset, Offset+Limit) and whether more
+	// follow.
+	Search(ctx context.Context, q SearchQuery) ([]SearchHit, bool, error)
+}
+
+var jobSearch JobSearcher
+
+// InitSearch picks the searcher from SEARCH_BACKEND: "mongo" (the default)
+// or "memory", which is filled from the jobs collection at start.
+func InitSearch() {
+	if os.Getenv("SEARCH_BACKEND") != "memory" {
+		jobSearch = MongoJobSearcher{Col: JobsCol}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	idx := NewMemoryJobSearcher()
+	jobs, err := findAllFor[Job](ctx, JobsCol, bson.M{"status": StatusPublished})
+	if err != nil {
+		log.Fatal("Loading search index:", err)
+	}
+	for _, job := range jobs {
+		idx.Index(ctx, job)
+	}
+	log.Printf("Search index loaded with %d jobs", len(jobs))
+	jobSearch = idx
+}
+
+// reindexJob keeps the searcher in step after a write. The write has
+// already succeeded, so a failure here is only logged.
+func reindexJob(ctx context.Context, job Job) {
+	if err := jobSearch.Index(ctx, job); err != nil {
+		log.Println("search index:", err)
+	}
+}
+
+func unindexJob(ctx context.Context, id primitive.ObjectID) {
+	if err := jobSearch.Remove(ctx, id); err != nil {
+		log.Println("search index:", err)
+	}
+}
+
+// MongoJobSearcher queries the job_text index. Mongo maintains the index
+// itself, so Index and Remove have nothing to do.
+type MongoJobSearcher struct {
+	Col *mongo.Collection
+}
+
+func (s MongoJobSearcher) Index(ctx context.Context, job Job) error { return nil }
+
+func (s MongoJobSearcher) Remove(ctx context.Context, id primitive.ObjectID) error { return nil }
+
+func (s MongoJobSearcher) Search(ctx context.Context, q SearchQuery) ([]SearchHit, bool, error) {
+	filter := bson.M{"$and": bson.A{
+		bson.M{"$text": bson.M{"$search": q.Text}},
+		q.Filter.bson(),
+	}}
+	score := bson.M{"$meta": "textScore"}
+	cur, err := s.Col.Find(ctx, filter, options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(q.Offset)).
+		SetLimit(int64(q.Limit+1)))
+	if err != nil {
+		return nil, false, err
+	}
+	defer cur.Close(ctx)
+
+	var docs []struct {
+		Job   `bson:",inline"`
+		Score float64 `bson:"score"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, false, err
+	}
+
+	more := len(docs) > q.Limit
+	if more {
+		docs = docs[:q.Limit]
+	}
+	hits := make([]SearchHit, len(docs))
+	for i, d := range docs {
+		hits[i] = SearchHit{Job: d.Job, Score: d.Score}
+	}
+	return hits, more, nil
+}
+
+// MemoryJobSearcher is an in-process inverted index scored with field
+// weights times inverse document frequency.
+type MemoryJobSearcher struct {
+	mu   sync.RWMutex
+	jobs map[primitive.ObjectID]Job
+	// postings maps a term to the weighted frequency of it in each job.
+	postings map[string]map[primitive.ObjectID]float64
+}
+
+func NewMemoryJobSearcher() *MemoryJobSearcher {
+	return &MemoryJobSearcher{
+		jobs:     map[primitive.ObjectID]Job{},
+		postings: map[string]map[primitive.ObjectID]float64{},
+	}
+}
+
+func (s *MemoryJobSearcher) Index(ctx context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(job.ID)
+	if job.Status != StatusPublished {
+		return nil
+	}
+
+	s.jobs[job.ID] = job
+	for field, text := range jobSearchFields(job) {
+		for _, term := range searchTerms(text) {
+			p := s.postings[term]
+			if p == nil {
+				p = map[primitive.ObjectID]float64{}
+				s.postings[term] = p
+			}
+			p[job.ID] += searchWeights[field]
+		}
+	}
+	return nil
+}
+
+func (s *MemoryJobSearcher) Remove(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(id)
+	return nil
+}
+
+func (s *MemoryJobSearcher) remove(id primitive.ObjectID) {
+	job, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+	delete(s.jobs, id)
+	for _, text := range jobSearchFields(job) {
+		for _, term := range searchTerms(text) {
+			if p := s.postings[term]; p != nil {
+				delete(p, id)
+				if len(p) == 0 {
+					delete(s.postings, term)
+				}
+			}
+		}
+	}
+}
+
+func (s *MemoryJobSearcher) Search(ctx context.Context, q SearchQuery) ([]SearchHit, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := float64(len(s.jobs))
+	scores := map[primitive.ObjectID]float64{}
+	for _, term := range uniqueTerms(searchTerms(q.Text)) {
+		p := s.postings[term]
+		idf := math.Log(1 + n/float64(len(p)+1))
+		for id, tf := range p {
+			scores[id] += tf * idf
+		}
+	}
+
+	var hits []SearchHit
+	for id, score := range scores {
+		if job := s.jobs[id]; q.Filter.matches(job) {
+			hits = append(hits, SearchHit{Job: job, Score: score})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Job.ID.Hex() > hits[j].Job.ID.Hex()
+	})
+
+	if q.Offset >= len(hits) {
+		return []SearchHit{}, false, nil
+	}
+	hits = hits[q.Offset:]
+	more := len(hits) > q.Limit
+	if more {
+		hits = hits[:q.Limit]
+	}
+	return hits, more, nil
+}
+
+func jobSearchFields(job Job) map[string]string {
+	return map[string]string{
+		"title":       job.Title,
+		"description": job.Description,
+		"skills":      strings.Join(job.Skills, ", "),
+	}
+}
+
+// searchWord also keeps + and # so skills like C++ and C# stay searchable.
+var searchWord = regexp.MustCompile(`[\p{L}\p{N}+#]+`)
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "in": true, "is": true,
+	"it": true, "of": true, "on": true, "or": true, "the": true, "to": true,
+	"we": true, "with": true, "you": true, "our": true, "will": true,
+}
+
+// searchTerms splits text into lower-cased, stemmed terms without stop words.
+func searchTerms(text string) []string {
+	var terms []string
+	for _, w := range searchWord.FindAllString(strings.ToLower(text), -1) {
+		if stopWords[w] {
+			continue
+		}
+		terms = append(terms, stem(w))
+	}
+	return terms
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// stem strips the common English suffixes so that "developers" finds
+// "developer". It is deliberately crude; the Mongo index stems properly.
+func stem(w string) string {
+	for _, suffix := range []string{"ing", "ed", "es", "s"} {
+		if strings.HasSuffix(w, suffix) && len(w)-len(suffix) >= 3 {
+			return strings.TrimSuffix(w, suffix)
+		}
+	}
+	return w
+}
+
+const snippetLength = 160
+
+// highlightJob marks the query terms in each field that contains one. Long
+// descriptions are cut to a window around the first match.
+func highlightJob(job Job, query string) map[string]string {
+	terms := map[string]bool{}
+	for _, t := range searchTerms(query) {
+		terms[t] = true
+	}
+
+	out := map[string]string{}
+	for field, text := range jobSearchFields(job) {
+		limit := 0
+		if field == "description" {
+			limit = snippetLength
+		}
+		if h, ok := highlight(text, terms, limit); ok {
+			out[field] = h
+		}
+	}
+	return out
+}
+
+// highlight wraps the words of text whose stem is in terms in <mark> and
+// escapes the rest. With limit > 0 only about limit bytes around the first
+// match are kept.
+func highlight(text string, terms map[string]bool, limit int) (string, bool) {
+	var matches [][]int
+	for _, loc := range searchWord.FindAllStringIndex(text, -1) {
+		if terms[stem(strings.ToLower(text[loc[0]:loc[1]]))] {
+			matches = append(matches, loc)
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+
+	start, end := 0, len(text)
+	if limit > 0 && len(text) > limit {
+		start = matches[0][0] - limit/4
+		if start < 0 {
+			start = 0
+		}
+		end = start + limit
+		if end > len(text) {
+			end, start = len(text), max(0, len(text)-limit)
+		}
+		start, end = wordBoundary(text, start, -1), wordBoundary(text, end, 1)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, m := range matches {
+		if m[0] < start || m[1] > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:m[0]]))
+		b.WriteString("<mark>" + html.EscapeString(text[m[0]:m[1]]) + "</mark>")
+		pos = m[1]
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// wordBoundary moves i to the nearest space in direction dir so snippets
+// do not start or end mid-word (or mid-rune).
+func wordBoundary(text string, i, dir int) int {
+	for i > 0 && i < len(text) && text[i] != ' ' {
+		i += dir
+	}
+	if dir < 0 && i > 0 {
+		i++
+	}
+	return i
+}
+
+// SearchJobs ranks published jobs by relevance to ?q=. The GET /api/jobs filters
+// apply as well; q itself is the search text here, not a keyword filter.
+func SearchJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	q := r.URL.Query()
+	text := strings.TrimSpace(q.Get("q"))
+	if text == "" || len(text) > maxSearchLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "q must be between 1 and 200 characters"})
+		return
+	}
+
+	limit, err := pageSize(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	offset := 0
+	if c := q.Get("cursor"); c != "" {
+		if offset, err = decodeOffsetCursor(c); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	jf, err := parseJobFilter(r, q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	jf.Keywords = nil
+	jf.Status = ""
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hits, more, err := jobSearch.Search(ctx, SearchQuery{Text: text, Filter: jf, Offset: offset, Limit: limit})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Search failed"})
+		return
+	}
+	manages := jobViewer(r)
+	for i := range hits {
+		hits[i].Highlights = highlightJob(hits[i].Job, text)
+		if !manages(hits[i].Job) {
+			hits[i].Job.Questions = publicQuestions(hits[i].Job.Questions)
+		}
+	}
+
+	resp := struct {
+		Results    []SearchHit `json:"results"`
+		NextCursor string      `json:"nextCursor,omitempty"`
+	}{Results: hits}
+	if resp.Results == nil {
+		resp.Results = []SearchHit{}
+	}
+	if more {
+		resp.NextCursor = encodeOffsetCursor(offset + len(hits))
+	}
+	json.NewEncoder(w).Encode(resp)
+}
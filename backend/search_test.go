@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func searchJob(title, description string, skills ...string) Job {
+	return Job{
+		ID:          primitive.NewObjectID(),
+		Title:       title,
+		Description: description,
+		Skills:      skills,
+		Status:      StatusPublished,
+	}
+}
+
+func searchTitles(t *testing.T, s JobSearcher, q SearchQuery) ([]string, bool) {
+	t.Helper()
+	if q.Limit == 0 {
+		q.Limit = 20
+	}
+	hits, more, err := s.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := make([]string, len(hits))
+	for i, h := range hits {
+		titles[i] = h.Job.Title
+	}
+	return titles, more
+}
+
+func TestMemorySearchRanksByField(t *testing.T) {
+	s := NewMemoryJobSearcher()
+	ctx := context.Background()
+	s.Index(ctx, searchJob("Backend engineer", "Kubernetes and Postgres", "Kotlin"))
+	s.Index(ctx, searchJob("Platform engineer", "Services written in Kotlin", "Postgres"))
+	s.Index(ctx, searchJob("Kotlin developer", "Android apps", "Gradle"))
+	s.Index(ctx, searchJob("Designer", "Figma", "Sketch"))
+
+	got, _ := searchTitles(t, s, SearchQuery{Text: "kotlin"})
+	want := []string{"Kotlin developer", "Platform engineer", "Backend engineer"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("ranking = %q, want title, then description, then skills: %q", got, want)
+	}
+}
+
+func TestStem(t *testing.T) {
+	tests := []struct{ word, want string }{
+		{"developers", "developer"},
+		{"testing", "test"},
+		{"deployed", "deploy"},
+		{"databases", "databas"},
+		{"database", "database"},
+		{"sing", "sing"},
+		{"go", "go"},
+	}
+	for _, tt := range tests {
+		if got := stem(tt.word); got != tt.want {
+			t.Errorf("stem(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+
+	s := NewMemoryJobSearcher()
+	s.Index(context.Background(), searchJob("Senior Developer", "Testing distributed systems"))
+	for _, q := range []string{"developers", "tested", "tests", "the testing"} {
+		if got, _ := searchTitles(t, s, SearchQuery{Text: q}); len(got) != 1 {
+			t.Errorf("%q found %q, want the job", q, got)
+		}
+	}
+}
+
+func TestMemorySearchDropsUnpublishedJobs(t *testing.T) {
+	s := NewMemoryJobSearcher()
+	ctx := context.Background()
+
+	paused := searchJob("Rust engineer", "Embedded work")
+	s.Index(ctx, paused)
+	paused.Status = StatusPaused
+	s.Index(ctx, paused)
+
+	draft := searchJob("Rust developer", "Compilers")
+	draft.Status = StatusDraft
+	s.Index(ctx, draft)
+
+	removed := searchJob("Rust programmer", "Tooling")
+	s.Index(ctx, removed)
+	s.Remove(ctx, removed.ID)
+
+	if got, _ := searchTitles(t, s, SearchQuery{Text: "rust"}); len(got) != 0 {
+		t.Fatalf("found %q, want nothing", got)
+	}
+	if len(s.jobs) != 0 || len(s.postings) != 0 {
+		t.Fatalf("index not empty: %d jobs, %d terms", len(s.jobs), len(s.postings))
+	}
+}
+
+func TestMemorySearchPaging(t *testing.T) {
+	s := NewMemoryJobSearcher()
+	for i := 0; i < 5; i++ {
+		s.Index(context.Background(), searchJob(fmt.Sprintf("Go engineer %d", i), "Services"))
+	}
+
+	seen := map[string]bool{}
+	for _, page := range []struct {
+		offset, n int
+		more      bool
+	}{{0, 2, true}, {2, 2, true}, {4, 1, false}, {10, 0, false}} {
+		got, more := searchTitles(t, s, SearchQuery{Text: "go", Offset: page.offset, Limit: 2})
+		if len(got) != page.n || more != page.more {
+			t.Fatalf("offset %d: %d hits, more %v; want %d, %v", page.offset, len(got), more, page.n, page.more)
+		}
+		for _, title := range got {
+			if seen[title] {
+				t.Fatalf("offset %d: %q repeated", page.offset, title)
+			}
+			seen[title] = true
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	terms := map[string]bool{"go": true}
+
+	got, ok := highlight(`<b>Go</b> & "Rust"`, terms, 0)
+	if want := `&lt;b&gt;<mark>Go</mark>&lt;/b&gt; &amp; &#34;Rust&#34;`; !ok || got != want {
+		t.Fatalf("highlight = %q, want %q", got, want)
+	}
+	if _, ok := highlight("Rust and Zig", terms, 0); ok {
+		t.Fatal("highlight matched text without the term")
+	}
+
+	text := strings.Repeat("café crème ", 20) + "we write Go daily " + strings.Repeat("naïve résumé ", 20)
+	got, ok = highlight(text, terms, 60)
+	if !ok || !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") || !strings.Contains(got, "<mark>Go</mark>") {
+		t.Fatalf("snippet = %q", got)
+	}
+	if !utf8.ValidString(got) {
+		t.Fatalf("snippet cut inside a rune: %q", got)
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(got, "…"), "…")
+	inner = html.UnescapeString(strings.NewReplacer("<mark>", "", "</mark>", "").Replace(inner))
+	if !strings.Contains(" "+text+" ", " "+inner+" ") {
+		t.Fatalf("snippet %q does not start and end on word boundaries", inner)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Session is a refresh token issued at login. Only the SHA-256 of the token is
+// stored; rotating a refresh token revokes the old session and points it at
+// its replacement so that reuse of a stolen token can be detected.
+type Session struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID     string              `bson:"userId" json:"userId"`
+	TokenHash  string              `bson:"tokenHash" json:"-"`
+	UserAgent  string              `bson:"userAgent" json:"userAgent"`
+	CreatedAt  time.Time           `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time           `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt  *time.Time          `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	ReplacedBy *primitive.ObjectID `bson:"replacedBy,omitempty" json:"-"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+	All          bool   `json:"all"`
+}
+
+// generateToken returns a random URL-safe token and the hash to persist for it.
+func generateToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(b)
+	return raw, hashToken(raw), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// signAccessToken mints a short-lived access token bound to the session and
+// the user's current session version.
+func signAccessToken(user User, sessionID string) (string, error) {
+	claims := Claims{
+		UserID:         user.ID.Hex(),
+		Email:          user.Email,
+		Role:           userRole(user),
+		SessionID:      sessionID,
+		SessionVersion: user.SessionVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return keyring.Sign(claims)
+}
+
+// createSession stores a new refresh token for the user and returns the raw
+// token together with the session id.
+func createSession(ctx context.Context, user User, userAgent string) (string, primitive.ObjectID, error) {
+	raw, hash, err := generateToken()
+	if err != nil {
+		return "", primitive.NilObjectID, err
+	}
+
+	now := time.Now()
+	session := Session{
+		UserID:    user.ID.Hex(),
+		TokenHash: hash,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(refreshTokenTTL),
+	}
+	res, err := SessionsCol.InsertOne(ctx, session)
+	if err != nil {
+		return "", primitive.NilObjectID, err
+	}
+	return raw, res.InsertedID.(primitive.ObjectID), nil
+}
+
+// issueTokens creates a new session for the user and returns the access and
+// refresh token pair for it.
+func issueTokens(ctx context.Context, user User, userAgent string) (LoginResponse, primitive.ObjectID, error) {
+	raw, sessionID, err := createSession(ctx, user, userAgent)
+	if err != nil {
+		return LoginResponse{}, sessionID, err
+	}
+
+	access, err := signAccessToken(user, sessionID.Hex())
+	if err != nil {
+		return LoginResponse{}, sessionID, err
+	}
+
+	resp := LoginResponse{
+		Token:        access,
+		RefreshToken: raw,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		User: &LoginUser{
+			ID:    user.ID.Hex(),
+			Email: user.Email,
+			Role:  userRole(user),
+		},
+	}
+	return resp, sessionID, nil
+}
+
+// revokeAllSessions revokes every refresh token of the user and bumps the
+// session version so that access tokens already handed out stop working too.
+func revokeAllSessions(ctx context.Context, userID string) error {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = SessionsCol.UpdateMany(ctx,
+		bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": now}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = UsersCol.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$inc": bson.M{"sessionVersion": 1}})
+	return err
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Presenting an already rotated token revokes every session of
+// the user, since it means the token has been copied.
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Refresh token is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var session Session
+	err := SessionsCol.FindOne(ctx, bson.M{"tokenHash": hashToken(req.RefreshToken)}).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid refresh token"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+		return
+	}
+
+	if session.RevokedAt != nil {
+		if session.ReplacedBy != nil {
+			_ = revokeAllSessions(ctx, session.UserID)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Refresh token has been revoked"})
+		return
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Refresh token has expired"})
+		return
+	}
+
+	user, err := findUserByID(ctx, session.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid refresh token"})
+		return
+	}
+
+	// Claim the old session atomically so two concurrent refreshes with the
+	// same token cannot both succeed.
+	res, err := SessionsCol.UpdateOne(ctx,
+		bson.M{"_id": session.ID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+		return
+	}
+	if res.ModifiedCount == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Refresh token has been revoked"})
+		return
+	}
+
+	resp, newSessionID, err := issueTokens(ctx, user, r.UserAgent())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create token"})
+		return
+	}
+	_, _ = SessionsCol.UpdateOne(ctx, bson.M{"_id": session.ID}, bson.M{"$set": bson.M{"replacedBy": newSessionID}})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Logout revokes the current session, or every session of the user when
+// "all" is set.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+	sessionID, _ := r.Context().Value("sessionId").(string)
+	if userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	var req LogoutRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if req.All {
+		if err := revokeAllSessions(ctx, userID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to log out"})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Logged out of all sessions"})
+		return
+	}
+
+	filter := bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}}
+	if req.RefreshToken != "" {
+		filter["tokenHash"] = hashToken(req.RefreshToken)
+	} else if oid, err := primitive.ObjectIDFromHex(sessionID); err == nil {
+		filter["_id"] = oid
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Refresh token is required"})
+		return
+	}
+
+	if _, err := SessionsCol.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to log out"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
+}
+
+func RegisterSessionRoutes(r *mux.Router) {
+	r.HandleFunc("/api/token/refresh", RefreshToken).Methods("POST")
+	r.HandleFunc("/api/logout", JWTMiddleware(Logout)).Methods("POST")
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/sha3"
+)
+
+const siweNonceTTL = 10 * time.Minute
+
+// SiweNonce is a one-time nonce handed out before the wallet signs a
+// Sign-In with Ethereum message.
+type SiweNonce struct {
+	Nonce     string    `bson:"nonce"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// SiweNonceStore keeps the nonces handed out until they are used or expire.
+// The Mongo store is shared between instances; the memory store is enough
+// for a single node.
+type SiweNonceStore interface {
+	Issue(ctx context.Context, n SiweNonce) error
+	// Consume deletes the nonce and reports whether it was still valid.
+	Consume(ctx context.Context, nonce string, now time.Time) (bool, error)
+}
+
+var siweNonces SiweNonceStore
+
+// InitSiwe picks the nonce store from SIWE_NONCE_STORE: "mongo" (the
+// default) or "memory". With APP_ENV=production the server refuses to start
+// unless SIWE_DOMAIN or APP_URL names the site's domain.
+func InitSiwe() {
+	if os.Getenv("APP_ENV") == "production" && os.Getenv("SIWE_DOMAIN") == "" && os.Getenv("APP_URL") == "" {
+		log.Fatal("SIWE: SIWE_DOMAIN or APP_URL must be set in production")
+	}
+	if os.Getenv("SIWE_NONCE_STORE") == "memory" {
+		siweNonces = NewMemoryNonceStore()
+		return
+	}
+	siweNonces = MongoNonceStore{Col: SiweNoncesCol}
+}
+
+// MongoNonceStore keeps one document per nonce. A TTL index on expiresAt
+// drops the unused ones.
+type MongoNonceStore struct {
+	Col *mongo.Collection
+}
+
+func (s MongoNonceStore) Issue(ctx context.Context, n SiweNonce) error {
+	_, err := s.Col.InsertOne(ctx, n)
+	return err
+}
+
+func (s MongoNonceStore) Consume(ctx context.Context, nonce string, now time.Time) (bool, error) {
+	err := s.Col.FindOneAndDelete(ctx, bson.M{"nonce": nonce, "expiresAt": bson.M{"$gt": now}}).Err()
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MemoryNonceStore is an in-process nonce store.
+type MemoryNonceStore struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{entries: map[string]time.Time{}}
+}
+
+func (s *MemoryNonceStore) Issue(ctx context.Context, n SiweNonce) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Opportunistically drop expired nonces so the map cannot grow forever.
+	if len(s.entries) > 10000 {
+		for k, exp := range s.entries {
+			if n.CreatedAt.After(exp) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	s.entries[n.Nonce] = n.ExpiresAt
+	return nil
+}
+
+func (s *MemoryNonceStore) Consume(ctx context.Context, nonce string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.entries[nonce]
+	delete(s.entries, nonce)
+	return ok && now.Before(exp), nil
+}
+
+type SiweVerifyRequest struct {
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+// SiweMessage holds the fields of an EIP-4361 message.
+type SiweMessage struct {
+	Domain         string
+	Address        string
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        string
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestID      string
+	Resources      []string
+}
+
+const siweHeaderSuffix = " wants you to sign in with your Ethereum account:"
+
+// parseSiweMessage parses the text format defined by EIP-4361.
+func parseSiweMessage(text string) (SiweMessage, error) {
+	var m SiweMessage
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], siweHeaderSuffix) {
+		return m, errors.New("missing SIWE header")
+	}
+	m.Domain = strings.TrimSuffix(lines[0], siweHeaderSuffix)
+	m.Address = strings.TrimSpace(lines[1])
+	if !isHexAddress(m.Address) {
+		return m, errors.New("invalid address")
+	}
+
+	i := 2
+	// An optional statement sits between two blank lines.
+	if i < len(lines) && lines[i] == "" {
+		i++
+		if i < len(lines) && !strings.HasPrefix(lines[i], "URI: ") {
+			m.Statement = lines[i]
+			i++
+			if i < len(lines) && lines[i] == "" {
+				i++
+			}
+		}
+	}
+
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "- ") {
+			m.Resources = append(m.Resources, strings.TrimPrefix(line, "- "))
+			continue
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			if line == "Resources:" {
+				continue
+			}
+			return m, fmt.Errorf("malformed line %q", line)
+		}
+		switch key {
+		case "URI":
+			m.URI = value
+		case "Version":
+			m.Version = value
+		case "Chain ID":
+			m.ChainID = value
+		case "Nonce":
+			m.Nonce = value
+		case "Issued At":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return m, errors.New("invalid Issued At")
+			}
+			m.IssuedAt = t
+		case "Expiration Time":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return m, errors.New("invalid Expiration Time")
+			}
+			m.ExpirationTime = &t
+		case "Not Before":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return m, errors.New("invalid Not Before")
+			}
+			m.NotBefore = &t
+		case "Request ID":
+			m.RequestID = value
+		default:
+			return m, fmt.Errorf("unknown field %q", key)
+		}
+	}
+
+	if m.URI == "" || m.Version == "" || m.ChainID == "" || m.Nonce == "" || m.IssuedAt.IsZero() {
+		return m, errors.New("missing required field")
+	}
+	if m.Version != "1" {
+		return m, errors.New("unsupported version")
+	}
+	return m, nil
+}
+
+func isHexAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(s[2:])
+	return err == nil
+}
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// recoverPersonalSign returns the lowercase address that produced an EIP-191
+// personal_sign signature over msg.
+func recoverPersonalSign(msg, sigHex string) (string, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(sigHex, "0x"))
+	if err != nil || len(sig) != 65 {
+		return "", errors.New("invalid signature")
+	}
+
+	// Wallets append v as 27/28 (or 0/1); decred expects it up front.
+	v := sig[64]
+	if v < 27 {
+		v += 27
+	}
+	if v != 27 && v != 28 {
+		return "", errors.New("invalid signature recovery id")
+	}
+	compact := make([]byte, 65)
+	compact[0] = v
+	copy(compact[1:], sig[:64])
+
+	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(msg))
+	hash := keccak256([]byte(prefix), []byte(msg))
+
+	pub, _, err := ecdsa.RecoverCompact(compact, hash)
+	if err != nil {
+		return "", errors.New("invalid signature")
+	}
+	addr := keccak256(pub.SerializeUncompressed()[1:])[12:]
+	return "0x" + hex.EncodeToString(addr), nil
+}
+
+// siweDomain is the domain SIWE messages must be bound to: SIWE_DOMAIN, or
+// the host of APP_URL. It never comes from the request, whose Host header the
+// client controls.
+func siweDomain() string {
+	if d := os.Getenv("SIWE_DOMAIN"); d != "" {
+		return d
+	}
+	u, err := url.Parse(appURL())
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// SiweNonceHandler hands out a nonce to embed in the SIWE message.
+func SiweNonceHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	raw, _, err := generateToken()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create nonce"})
+		return
+	}
+	// EIP-4361 nonces are alphanumeric.
+	nonce := strings.NewReplacer("-", "", "_", "").Replace(raw)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	err = siweNonces.Issue(ctx, SiweNonce{Nonce: nonce, CreatedAt: now, ExpiresAt: now.Add(siweNonceTTL)})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create nonce"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"nonce": nonce, "expiresAt": now.Add(siweNonceTTL)})
+}
+
+// SiweVerify checks a signed SIWE message and logs the wallet owner in. When
+// called with a valid access token the wallet is linked to that account;
+// otherwise the account owning the wallet is used, or a new one is created.
+func SiweVerify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req SiweVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Message == "" || req.Signature == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Message and signature are required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	signer, status, err := verifySiwe(ctx, req, time.Now())
+	if err != nil {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	user, status, err := siweUser(ctx, r, signer)
+	if err != nil {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	_, _ = ProfilesCol.UpdateOne(ctx,
+		bson.M{"userId": user.ID.Hex()},
+		bson.M{"$set": bson.M{"userId": user.ID.Hex(), "walletAddress": signer, "updatedAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+
+	resp, err := completeLogin(ctx, user, r.UserAgent())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create token"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// verifySiwe checks a signed SIWE message against the request and consumes
+// its nonce. It returns the lowercase address of the signer.
+func verifySiwe(ctx context.Context, req SiweVerifyRequest, now time.Time) (string, int, error) {
+	msg, err := parseSiweMessage(req.Message)
+	if err != nil {
+		return "", http.StatusBadRequest, errors.New("Invalid SIWE message: " + err.Error())
+	}
+	if msg.Domain != siweDomain() {
+		return "", http.StatusUnauthorized, errors.New("SIWE message is for a different domain")
+	}
+	if msg.ExpirationTime != nil && now.After(*msg.ExpirationTime) {
+		return "", http.StatusUnauthorized, errors.New("SIWE message has expired")
+	}
+	if msg.NotBefore != nil && now.Before(*msg.NotBefore) {
+		return "", http.StatusUnauthorized, errors.New("SIWE message is not yet valid")
+	}
+
+	signer, err := recoverPersonalSign(req.Message, req.Signature)
+	if err != nil || signer != strings.ToLower(msg.Address) {
+		return "", http.StatusUnauthorized, errors.New("Signature does not match address")
+	}
+
+	// Consume the nonce only once the signature checks out, so a forged
+	// request cannot burn someone else's nonce.
+	ok, err := siweNonces.Consume(ctx, msg.Nonce, now)
+	if err != nil {
+		return "", http.StatusInternalServerError, errors.New("Database error")
+	}
+	if !ok {
+		return "", http.StatusUnauthorized, errors.New("Nonce is invalid or has already been used")
+	}
+	return signer, http.StatusOK, nil
+}
+
+// siweUser resolves the account a verified wallet signs in to.
+func siweUser(ctx context.Context, r *http.Request, wallet string) (User, int, error) {
+	var owner User
+	err := UsersCol.FindOne(ctx, bson.M{"walletAddress": wallet}).Decode(&owner)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return owner, http.StatusInternalServerError, errors.New("Database error")
+	}
+	walletTaken := err == nil
+
+	// Linking to the account of the caller.
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		claims, err := parseAccessToken(auth[7:])
+		if err != nil {
+			return owner, http.StatusUnauthorized, errors.New("Invalid or expired token")
+		}
+		user, err := sessionUser(ctx, claims)
+		if err != nil {
+			return user, http.StatusUnauthorized, errors.New("Session has been revoked")
+		}
+		if walletTaken && owner.ID != user.ID {
+			return user, http.StatusConflict, errors.New("Wallet is already linked to another account")
+		}
+		if _, err := UsersCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"walletAddress": wallet}}); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return user, http.StatusConflict, errors.New("Wallet is already linked to another account")
+			}
+			return user, http.StatusInternalServerError, errors.New("Failed to link wallet")
+		}
+		user.WalletAddress = wallet
+		return user, http.StatusOK, nil
+	}
+
+	if walletTaken {
+		return owner, http.StatusOK, nil
+	}
+
+	user := User{
+		WalletAddress: wallet,
+		Role:          RoleCandidate,
+		CreatedAt:     time.Now(),
+	}
+	res, err := UsersCol.InsertOne(ctx, user)
+	if err != nil {
+		return user, http.StatusInternalServerError, errors.New("Failed to create user")
+	}
+	user.ID = res.InsertedID.(primitive.ObjectID)
+	return user, http.StatusCreated, nil
+}
+
+func RegisterSiweRoutes(r *mux.Router) {
+	r.HandleFunc("/api/siwe/nonce", SiweNonceHandler).Methods("GET")
+	r.HandleFunc("/api/siwe/verify", SiweVerify).Methods("POST")
+}
@@ -0,0 +1,641 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Skill is an entry of the skill taxonomy. Name is how the skill is shown;
+// Key, its lower-cased form, is what jobs and profiles are matched on.
+// Aliases are other spellings that mean the same skill.
+type Skill struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name      string             `bson:"name" json:"name"`
+	Key       string             `bson:"key" json:"-"`
+	Aliases   []string           `bson:"aliases" json:"aliases"`
+	Category  string             `bson:"category" json:"category"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+var skillCategories = map[string]bool{
+	"language":   true,
+	"framework":  true,
+	"database":   true,
+	"cloud":      true,
+	"devops":     true,
+	"data":       true,
+	"design":     true,
+	"blockchain": true,
+	"practice":   true,
+	"other":      true,
+}
+
+// defaultSkills seeds an empty taxonomy. Seeding never overwrites entries,
+// so admins' edits survive restarts.
+var defaultSkills = []Skill{
+	{Name: "JavaScript", Category: "language", Aliases: []string{"js", "ecmascript"}},
+	{Name: "TypeScript", Category: "language", Aliases: []string{"ts"}},
+	{Name: "Go", Category: "language", Aliases: []string{"golang"}},
+	{Name: "Python", Category: "language", Aliases: []string{"py", "python3"}},
+	{Name: "Java", Category: "language"},
+	{Name: "Kotlin", Category: "language"},
+	{Name: "Swift", Category: "language"},
+	{Name: "Rust", Category: "language", Aliases: []string{"rustlang"}},
+	{Name: "C#", Category: "language", Aliases: []string{"csharp", "c sharp"}},
+	{Name: "C++", Category: "language", Aliases: []string{"cpp"}},
+	{Name: "Ruby", Category: "language"},
+	{Name: "PHP", Category: "language"},
+	{Name: "SQL", Category: "language"},
+	{Name: "Solidity", Category: "blockchain", Aliases: []string{"sol"}},
+	{Name: "Node.js", Category: "framework", Aliases: []string{"node", "nodejs", "node js"}},
+	{Name: "React", Category: "framework", Aliases: []string{"reactjs", "react.js"}},
+	{Name: "Vue", Category: "framework", Aliases: []string{"vuejs", "vue.js"}},
+	{Name: "Angular", Category: "framework", Aliases: []string{"angularjs"}},
+	{Name: "Django", Category: "framework"},
+	{Name: "Spring", Category: "framework", Aliases: []string{"spring boot"}},
+	{Name: "PostgreSQL", Category: "database", Aliases: []string{"postgres", "psql"}},
+	{Name: "MySQL", Category: "database"},
+	{Name: "MongoDB", Category: "database", Aliases: []string{"mongo"}},
+	{Name: "Redis", Category: "database"},
+	{Name: "Amazon Web Services", Category: "cloud", Aliases: []string{"aws"}},
+	{Name: "Google Cloud", Category: "cloud", Aliases: []string{"gcp", "google cloud platform"}},
+	{Name: "Microsoft Azure", Category: "cloud", Aliases: []string{"azure"}},
+	{Name: "Docker", Category: "devops"},
+	{Name: "Kubernetes", Category: "devops", Aliases: []string{"k8s"}},
+	{Name: "Terraform", Category: "devops"},
+	{Name: "Continuous Integration", Category: "devops", Aliases: []string{"ci", "ci/cd"}},
+	{Name: "Machine Learning", Category: "data", Aliases: []string{"ml"}},
+	{Name: "Artificial Intelligence", Category: "data", Aliases: []string{"ai"}},
+	{Name: "Natural Language Processing", Category: "data", Aliases: []string{"nlp"}},
+	{Name: "User Experience", Category: "design", Aliases: []string{"ux"}},
+	{Name: "User Interface", Category: "design", Aliases: []string{"ui"}},
+	{Name: "Figma", Category: "design"},
+	{Name: "Ethereum", Category: "blockchain", Aliases: []string{"eth"}},
+	{Name: "Agile", Category: "practice", Aliases: []string{"scrum"}},
+}
+
+// foldSkill is the spelling-insensitive form names and aliases are looked up
+// by: lower-cased, with runs of spaces collapsed.
+func foldSkill(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// skillTaxonomy is the in-memory copy of the skills collection that
+// normalization and autocomplete read. It is reloaded periodically, so
+// changes made through another instance show up within
+// SKILLS_REFRESH_INTERVAL.
+var skillTaxonomy struct {
+	sync.RWMutex
+	skills []Skill
+	// byName maps folded names and aliases to an index into skills.
+	byName map[string]int
+	// popularity counts the published jobs and profiles using each key.
+	popularity map[string]int
+}
+
+// InitSkills seeds the taxonomy and loads it.
+func InitSkills() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	now := time.Now()
+	for _, s := range defaultSkills {
+		_, err := SkillsCol.UpdateOne(ctx, bson.M{"key": foldSkill(s.Name)}, bson.M{"$setOnInsert": bson.M{
+			"name":      s.Name,
+			"aliases":   foldedAliases(s.Aliases),
+			"category":  s.Category,
+			"createdAt": now,
+			"updatedAt": now,
+		}}, options.Update().SetUpsert(true))
+		if err != nil {
+			log.Println("skill taxonomy seed:", err)
+			break
+		}
+	}
+	if err := loadSkills(ctx); err != nil {
+		log.Println("skill taxonomy:", err)
+	}
+}
+
+// StartSkillRefresher reloads the taxonomy and skill popularity every
+// SKILLS_REFRESH_INTERVAL (10m by default).
+func StartSkillRefresher() {
+	interval := 10 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("SKILLS_REFRESH_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+	go func() {
+		for {
+			time.Sleep(interval)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := loadSkills(ctx); err != nil {
+				log.Println("skill taxonomy:", err)
+			}
+			cancel()
+		}
+	}()
+}
+
+// loadSkills reads the taxonomy and how often each skill is used.
+func loadSkills(ctx context.Context) error {
+	skills, err := findAllFor[Skill](ctx, SkillsCol, bson.M{}, options.Find().SetSort(bson.D{{Key: "key", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	byName := map[string]int{}
+	for i, s := range skills {
+		byName[s.Key] = i
+		for _, a := range s.Aliases {
+			if _, taken := byName[a]; !taken {
+				byName[a] = i
+			}
+		}
+	}
+
+	popularity := map[string]int{}
+	for _, q := range []struct {
+		col    *mongo.Collection
+		filter bson.M
+	}{
+		{JobsCol, bson.M{"status": StatusPublished}},
+		{ProfilesCol, bson.M{}},
+	} {
+		cur, err := q.col.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: q.filter}},
+			{{Key: "$unwind", Value: "$skillKeys"}},
+			{{Key: "$group", Value: bson.M{"_id": "$skillKeys", "n": bson.M{"$sum": 1}}}},
+		})
+		if err != nil {
+			return err
+		}
+		var counts []struct {
+			Key string `bson:"_id"`
+			N   int    `bson:"n"`
+		}
+		err = cur.All(ctx, &counts)
+		cur.Close(ctx)
+		if err != nil {
+			return err
+		}
+		for _, c := range counts {
+			popularity[c.Key] += c.N
+		}
+	}
+
+	skillTaxonomy.Lock()
+	skillTaxonomy.skills, skillTaxonomy.byName, skillTaxonomy.popularity = skills, byName, popularity
+	skillTaxonomy.Unlock()
+	return nil
+}
+
+func foldedAliases(aliases []string) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, a := range aliases {
+		if a = foldSkill(a); a != "" && !seen[a] {
+			seen[a] = true
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// canonicalSkill resolves a skill as typed to its taxonomy name and key.
+// Skills the taxonomy does not know keep their spelling, trimmed, and are
+// keyed by their folded form.
+func canonicalSkill(skill string) (name, key string) {
+	key = foldSkill(skill)
+	skillTaxonomy.RLock()
+	defer skillTaxonomy.RUnlock()
+	if i, ok := skillTaxonomy.byName[key]; ok {
+		s := skillTaxonomy.skills[i]
+		return s.Name, s.Key
+	}
+	return strings.Join(strings.Fields(skill), " "), key
+}
+
+// skillKey is the canonical key of a skill, so "golang", "Go" and "GoLang"
+// all match.
+func skillKey(skill string) string {
+	_, key := canonicalSkill(skill)
+	return key
+}
+
+// normalizeSkills replaces skills with their taxonomy names and drops
+// blanks and duplicates, keeping the order they were given in.
+func normalizeSkills(skills []string) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, s := range skills {
+		name, key := canonicalSkill(s)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, name)
+	}
+	return out
+}
+
+// MigrateSkills normalizes the skills of stored jobs and profiles, and
+// re-derives their keys, wherever they differ from what the taxonomy gives
+// now. Documents already normalized are left alone.
+func MigrateSkills() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	type doc struct {
+		ID        primitive.ObjectID `bson:"_id"`
+		Skills    []string           `bson:"skills"`
+		SkillKeys []string           `bson:"skillKeys"`
+	}
+	proj := options.Find().SetProjection(bson.M{"skills": 1, "skillKeys": 1})
+	for _, c := range []struct {
+		name string
+		col  *mongo.Collection
+	}{{"jobs", JobsCol}, {"profiles", ProfilesCol}} {
+		docs, err := findAllFor[doc](ctx, c.col, bson.M{"skills.0": bson.M{"$exists": true}}, proj)
+		if err != nil {
+			log.Println("skill migration:", err)
+			return
+		}
+		n := 0
+		for _, d := range docs {
+			skills := normalizeSkills(d.Skills)
+			keys := skillKeys(skills)
+			if equalStrings(skills, d.Skills) && equalStrings(keys, d.SkillKeys) {
+				continue
+			}
+			if _, err := c.col.UpdateByID(ctx, d.ID, bson.M{"$set": bson.M{"skills": skills, "skillKeys": keys}}); err != nil {
+				log.Println("skill migration:", err)
+				return
+			}
+			if c.col == JobsCol {
+				var job Job
+				if err := JobsCol.FindOne(ctx, bson.M{"_id": d.ID}).Decode(&job); err == nil {
+					reindexJob(ctx, job)
+				}
+			}
+			n++
+		}
+		if n > 0 {
+			log.Printf("Normalized the skills of %d %s", n, c.name)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	defaultSuggestions = 10
+	maxSuggestions     = 50
+)
+
+// SkillSuggestion is an autocomplete result. Popularity is the number of
+// published jobs and profiles listing the skill.
+type SkillSuggestion struct {
+	Name       string `json:"name"`
+	Category   string `json:"category"`
+	Popularity int    `json:"popularity"`
+	// Alias is set when q matched an alias rather than the name.
+	Alias string `json:"alias,omitempty"`
+}
+
+// SuggestSkills autocompletes ?q= against skill names, the words in them,
+// and aliases, most used skills first.
+func SuggestSkills(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	q := r.URL.Query()
+	prefix := foldSkill(q.Get("q"))
+	if prefix == "" || len(prefix) > 100 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "q must be between 1 and 100 characters"})
+		return
+	}
+	limit := defaultSuggestions
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "limit must be a positive number"})
+			return
+		}
+		limit = min(n, maxSuggestions)
+	}
+	category := q.Get("category")
+	if category != "" && !skillCategories[category] {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unknown category"})
+		return
+	}
+
+	skillTaxonomy.RLock()
+	var found []SkillSuggestion
+	for _, s := range skillTaxonomy.skills {
+		if category != "" && s.Category != category {
+			continue
+		}
+		sug := SkillSuggestion{Name: s.Name, Category: s.Category, Popularity: skillTaxonomy.popularity[s.Key]}
+		if !namePrefix(s.Key, prefix) {
+			alias := ""
+			for _, a := range s.Aliases {
+				if strings.HasPrefix(a, prefix) {
+					alias = a
+					break
+				}
+			}
+			if alias == "" {
+				continue
+			}
+			sug.Alias = alias
+		}
+		found = append(found, sug)
+	}
+	skillTaxonomy.RUnlock()
+
+	// An exact hit comes first, then the most used; names break ties.
+	sort.Slice(found, func(i, j int) bool {
+		ei, ej := foldSkill(found[i].Name) == prefix || found[i].Alias == prefix, foldSkill(found[j].Name) == prefix || found[j].Alias == prefix
+		if ei != ej {
+			return ei
+		}
+		if found[i].Popularity != found[j].Popularity {
+			return found[i].Popularity > found[j].Popularity
+		}
+		return found[i].Name < found[j].Name
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	if found == nil {
+		found = []SkillSuggestion{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"skills": found})
+}
+
+// namePrefix reports whether the name, or one of its words, starts with
+// prefix, so "learn" finds "Machine Learning".
+func namePrefix(name, prefix string) bool {
+	if strings.HasPrefix(name, prefix) {
+		return true
+	}
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return false
+	}
+	for _, w := range words[1:] {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSkillAliases caps the aliases of one skill, the old names kept on a
+// rename included.
+const maxSkillAliases = 20
+
+type SkillRequest struct {
+	Name     string   `json:"name"`
+	Aliases  []string `json:"aliases"`
+	Category string   `json:"category"`
+}
+
+// validate checks an admin's skill entry against the rest of the taxonomy:
+// no name or alias may already belong to another skill.
+func (req *SkillRequest) validate(self primitive.ObjectID) error {
+	req.Name = strings.Join(strings.Fields(req.Name), " ")
+	if req.Name == "" || len(req.Name) > 60 {
+		return errors.New("name must be between 1 and 60 characters")
+	}
+	if req.Category == "" {
+		req.Category = "other"
+	}
+	if !skillCategories[req.Category] {
+		return errors.New("unknown category")
+	}
+	key := foldSkill(req.Name)
+	req.Aliases = foldedAliases(req.Aliases)
+	for i, a := range req.Aliases {
+		if a == key {
+			req.Aliases = append(req.Aliases[:i], req.Aliases[i+1:]...)
+			break
+		}
+	}
+	if len(req.Aliases) > maxSkillAliases {
+		return fmt.Errorf("a skill can have at most %d aliases", maxSkillAliases)
+	}
+
+	skillTaxonomy.RLock()
+	defer skillTaxonomy.RUnlock()
+	for _, name := range append([]string{key}, req.Aliases...) {
+		if i, ok := skillTaxonomy.byName[name]; ok && skillTaxonomy.skills[i].ID != self {
+			return fmt.Errorf("%q already belongs to %s", name, skillTaxonomy.skills[i].Name)
+		}
+	}
+	return nil
+}
+
+// skillNameTaken looks names up in the skills collection itself, since the
+// in-memory taxonomy validate checks against may be behind another
+// instance's edits. It returns the other skill a name belongs to.
+func skillNameTaken(ctx context.Context, self primitive.ObjectID, names []string) (*Skill, error) {
+	var other Skill
+	err := SkillsCol.FindOne(ctx, bson.M{
+		"_id": bson.M{"$ne": self},
+		"$or": bson.A{bson.M{"key": bson.M{"$in": names}}, bson.M{"aliases": bson.M{"$in": names}}},
+	}).Decode(&other)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &other, nil
+}
+
+// writeSkillConflict answers a write whose names are taken, or reports
+// false when they are free.
+func writeSkillConflict(ctx context.Context, w http.ResponseWriter, self primitive.ObjectID, key string, aliases []string) bool {
+	other, err := skillNameTaken(ctx, self, append([]string{key}, aliases...))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to check the skill names"})
+		return true
+	}
+	if other == nil {
+		return false
+	}
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]string{"error": "A name or alias already belongs to " + other.Name})
+	return true
+}
+
+// ListSkills returns the whole taxonomy. Admin only.
+func ListSkills(w http.ResponseWriter, r *http.Request) {
+	skillTaxonomy.RLock()
+	skills := append([]Skill{}, skillTaxonomy.skills...)
+	skillTaxonomy.RUnlock()
+
+	json.NewEncoder(w).Encode(skills)
+}
+
+// CreateSkill adds a skill to the taxonomy. Admin only.
+func CreateSkill(w http.ResponseWriter, r *http.Request) {
+	var req SkillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if err := req.validate(primitive.NilObjectID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if writeSkillConflict(ctx, w, primitive.NilObjectID, foldSkill(req.Name), req.Aliases) {
+		return
+	}
+
+	now := time.Now()
+	skill := Skill{Name: req.Name, Key: foldSkill(req.Name), Aliases: req.Aliases, Category: req.Category, CreatedAt: now, UpdatedAt: now}
+	res, err := SkillsCol.InsertOne(ctx, skill)
+	if mongo.IsDuplicateKeyError(err) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "This skill already exists"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create skill"})
+		return
+	}
+	skill.ID = res.InsertedID.(primitive.ObjectID)
+
+	skillsChanged(ctx)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(skill)
+}
+
+// UpdateSkill renames a skill or changes its aliases or category. Admin
+// only. Jobs and profiles are re-normalized in the background.
+func UpdateSkill(w http.ResponseWriter, r *http.Request) {
+	oid, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Skill not found"})
+		return
+	}
+	var req SkillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if err := req.validate(oid); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var current Skill
+	if err := SkillsCol.FindOne(ctx, bson.M{"_id": oid}).Decode(&current); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Skill not found"})
+		return
+	}
+	// A renamed skill keeps its old name as an alias, so jobs and profiles
+	// that still use it resolve to the skill.
+	key := foldSkill(req.Name)
+	if key != current.Key && !slices.Contains(req.Aliases, current.Key) {
+		req.Aliases = append(req.Aliases, current.Key)
+	}
+	if len(req.Aliases) > maxSkillAliases {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("a skill can have at most %d aliases, including its old name %q", maxSkillAliases, current.Key)})
+		return
+	}
+	if writeSkillConflict(ctx, w, oid, key, req.Aliases) {
+		return
+	}
+
+	var skill Skill
+	err = SkillsCol.FindOneAndUpdate(ctx, bson.M{"_id": oid, "key": current.Key}, bson.M{"$set": bson.M{
+		"name":      req.Name,
+		"key":       key,
+		"aliases":   req.Aliases,
+		"category":  req.Category,
+		"updatedAt": time.Now(),
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&skill)
+	if err == mongo.ErrNoDocuments {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The skill was changed meanwhile, please try again"})
+		return
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Another skill already has this name"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update skill"})
+		return
+	}
+
+	skillsChanged(ctx)
+	json.NewEncoder(w).Encode(skill)
+}
+
+// skillsChanged reloads the taxonomy after an edit and re-normalizes stored
+// skills to match it.
+func skillsChanged(ctx context.Context) {
+	if err := loadSkills(ctx); err != nil {
+		log.Println("skill taxonomy:", err)
+	}
+	go MigrateSkills()
+}
+
+func RegisterSkillRoutes(r *mux.Router) {
+	admin := RequireRole(RoleAdmin)
+	r.HandleFunc("/api/skills", SuggestSkills).Methods("GET")
+	r.HandleFunc("/api/admin/skills", JWTMiddleware(admin(ListSkills))).Methods("GET")
+	r.HandleFunc("/api/admin/skills", JWTMiddleware(admin(CreateSkill))).Methods("POST")
+	r.HandleFunc("/api/admin/skills/{id}", JWTMiddleware(admin(UpdateSkill))).Methods("PUT")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// withSkills loads skills into the in-memory taxonomy for the test, the way
+// loadSkills indexes them.
+func withSkills(t *testing.T, skills ...Skill) {
+	t.Helper()
+	byName := map[string]int{}
+	for i, s := range skills {
+		byName[s.Key] = i
+		for _, a := range s.Aliases {
+			if _, taken := byName[a]; !taken {
+				byName[a] = i
+			}
+		}
+	}
+	skillTaxonomy.Lock()
+	oldSkills, oldByName := skillTaxonomy.skills, skillTaxonomy.byName
+	skillTaxonomy.skills, skillTaxonomy.byName = skills, byName
+	skillTaxonomy.Unlock()
+	t.Cleanup(func() {
+		skillTaxonomy.Lock()
+		skillTaxonomy.skills, skillTaxonomy.byName = oldSkills, oldByName
+		skillTaxonomy.Unlock()
+	})
+}
+
+func TestFoldSkill(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Go", "go"},
+		{"  Machine   Learning ", "machine learning"},
+		{"Node.js", "node.js"},
+		{"C++", "c++"},
+		{"\tSQL\n", "sql"},
+		{"", ""},
+		{"   ", ""},
+	}
+	for _, tt := range tests {
+		if got := foldSkill(tt.in); got != tt.want {
+			t.Errorf("foldSkill(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeSkills(t *testing.T) {
+	withSkills(t,
+		Skill{ID: primitive.NewObjectID(), Name: "Go", Key: "go", Aliases: []string{"golang"}},
+		Skill{ID: primitive.NewObjectID(), Name: "Machine Learning", Key: "machine learning", Aliases: []string{"ml"}},
+	)
+
+	tests := []struct {
+		in   []string
+		want []string
+	}{
+		{[]string{"golang", "ML"}, []string{"Go", "Machine Learning"}},
+		{[]string{"GoLang", "go", " Go "}, []string{"Go"}},
+		{[]string{"  Elixir  Phoenix ", "", "  "}, []string{"Elixir Phoenix"}},
+		{[]string{"ml", "Rust", "machine   learning"}, []string{"Machine Learning", "Rust"}},
+		{nil, []string{}},
+	}
+	for _, tt := range tests {
+		if got := normalizeSkills(tt.in); fmt.Sprint(got) != fmt.Sprint(tt.want) || got == nil {
+			t.Errorf("normalizeSkills(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNamePrefix(t *testing.T) {
+	tests := []struct {
+		name, prefix string
+		want         bool
+	}{
+		{"machine learning", "mach", true},
+		{"machine learning", "learn", true},
+		{"machine learning", "", true},
+		{"machine learning", "arn", false},
+		{"go", "golang", false},
+		{"natural language processing", "proc", true},
+		{"", "a", false},
+	}
+	for _, tt := range tests {
+		if got := namePrefix(tt.name, tt.prefix); got != tt.want {
+			t.Errorf("namePrefix(%q, %q) = %v, want %v", tt.name, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestSkillRequestValidate(t *testing.T) {
+	goID := primitive.NewObjectID()
+	withSkills(t, Skill{ID: goID, Name: "Go", Key: "go", Aliases: []string{"golang"}})
+
+	many := make([]string, maxSkillAliases+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("alias %d", i)
+	}
+	tests := []struct {
+		name string
+		self primitive.ObjectID
+		req  SkillRequest
+		ok   bool
+	}{
+		{"new skill", primitive.NilObjectID, SkillRequest{Name: "Rust", Aliases: []string{"rust-lang"}}, true},
+		{"name taken", primitive.NilObjectID, SkillRequest{Name: "GO"}, false},
+		{"alias taken", primitive.NilObjectID, SkillRequest{Name: "Golang Tools", Aliases: []string{"Golang"}}, false},
+		{"own names", goID, SkillRequest{Name: "Go", Aliases: []string{"golang", "go lang"}}, true},
+		{"blank name", primitive.NilObjectID, SkillRequest{Name: "   "}, false},
+		{"unknown category", primitive.NilObjectID, SkillRequest{Name: "Rust", Category: "food"}, false},
+		{"too many aliases", primitive.NilObjectID, SkillRequest{Name: "Rust", Aliases: many}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.validate(tt.self); (err == nil) != tt.ok {
+				t.Fatalf("validate error = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1 // accept codes from one step before/after
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+	mfaPurpose        = "mfa"
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfaToken"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// totpCode computes the RFC 6238 code (HMAC-SHA1, 6 digits) for a time step.
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, bin%1000000)
+}
+
+// verifyTOTP checks code against the base32 secret and returns the matching
+// time step, so callers can refuse to accept the same step twice.
+func verifyTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := b32.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for i := int64(-totpSkew); i <= totpSkew; i++ {
+		if hmac.Equal([]byte(totpCode(key, current+i)), []byte(code)) {
+			return current + i, true
+		}
+	}
+	return 0, false
+}
+
+func totpIssuer() string {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "RizeOS"
+	}
+	return issuer
+}
+
+func otpauthURI(secret, account string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer())
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer() + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// newRecoveryCodes returns fresh codes for the user and their hashes to store.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		c := strings.ToLower(b32.EncodeToString(b))
+		codes[i] = c[:4] + "-" + c[4:]
+		hashes[i] = hashToken(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	if len(code) == 8 {
+		code = code[:4] + "-" + code[4:]
+	}
+	return code
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code. Both are consumed atomically so neither can be replayed.
+func checkSecondFactor(ctx context.Context, user User, code, recoveryCode string) bool {
+	if recoveryCode != "" {
+		hash := hashToken(normalizeRecoveryCode(recoveryCode))
+		res, err := UsersCol.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "recoveryCodes": hash},
+			bson.M{"$pull": bson.M{"recoveryCodes": hash}},
+		)
+		return err == nil && res.ModifiedCount == 1
+	}
+
+	step, ok := verifyTOTP(user.TOTPSecret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return false
+	}
+	res, err := UsersCol.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "totpLastStep": bson.M{"$not": bson.M{"$gte": step}}},
+		bson.M{"$set": bson.M{"totpLastStep": step}},
+	)
+	return err == nil && res.ModifiedCount == 1
+}
+
+func signMFAChallenge(user User) (string, error) {
+	claims := Claims{
+		UserID:         user.ID.Hex(),
+		SessionVersion: user.SessionVersion,
+		Purpose:        mfaPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	return keyring.Sign(claims)
+}
+
+func parseMFAChallenge(tokenStr string) (*Claims, error) {
+	token, err := keyring.Parse(tokenStr, &Claims{})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired challenge")
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || claims.Purpose != mfaPurpose {
+		return nil, errors.New("invalid challenge")
+	}
+	return claims, nil
+}
+
+// completeLogin finishes a successful first-factor login: users with 2FA
+// get a short-lived challenge token to exchange at /api/login/mfa, everyone
+// else gets a session right away.
+func completeLogin(ctx context.Context, user User, userAgent string) (LoginResponse, error) {
+	if !user.TOTPEnabled {
+		resp, _, err := issueTokens(ctx, user, userAgent)
+		return resp, err
+	}
+
+	challenge, err := signMFAChallenge(user)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	return LoginResponse{MFARequired: true, MFAToken: challenge}, nil
+}
+
+// LoginMFA exchanges an MFA challenge token plus a TOTP or recovery code for
+// a session.
+func LoginMFA(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "MFA token and code are required"})
+		return
+	}
+
+	claims, err := parseMFAChallenge(req.MFAToken)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "MFA challenge is invalid or has expired"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := sessionUser(ctx, claims)
+	if err != nil || !user.TOTPEnabled {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "MFA challenge is invalid or has expired"})
+		return
+	}
+
+	// Six digits are easy to guess without a limit on attempts.
+	limitKeys := loginLimitKeys(r, "mfa:"+user.ID.Hex())
+	if wait := loginLockedFor(ctx, limitKeys); wait > 0 {
+		setRetryAfter(w, wait)
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Too many failed attempts. Please try again later."})
+		return
+	}
+
+	if !checkSecondFactor(ctx, user, req.Code, req.RecoveryCode) {
+		recordLoginFailure(ctx, r, limitKeys)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid authentication code"})
+		return
+	}
+	resetLoginFailures(ctx, limitKeys)
+
+	resp, _, err := issueTokens(ctx, user, r.UserAgent())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create token"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// EnrollTOTP creates a pending secret. 2FA is only turned on once a code from
+// it has been confirmed.
+func EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	if user.TOTPEnabled {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create secret"})
+		return
+	}
+	secret := b32.EncodeToString(key)
+
+	if _, err := UsersCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"totpPendingSecret": secret}}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to save secret"})
+		return
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.WalletAddress
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":     secret,
+		"otpauthUri": otpauthURI(secret, account),
+	})
+}
+
+// ConfirmTOTP turns on 2FA once the user proves their authenticator works,
+// and returns the recovery codes. They are only ever shown here.
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Code is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	if user.TOTPPendingSecret == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Start enrollment first"})
+		return
+	}
+
+	step, ok := verifyTOTP(user.TOTPPendingSecret, strings.TrimSpace(req.Code), time.Now())
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create recovery codes"})
+		return
+	}
+
+	_, err = UsersCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{
+			"totpEnabled":   true,
+			"totpSecret":    user.TOTPPendingSecret,
+			"totpLastStep":  step,
+			"recoveryCodes": hashes,
+		},
+		"$unset": bson.M{"totpPendingSecret": ""},
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableTOTP turns 2FA off. It requires the password (for accounts that
+// have one) and a current code or recovery code.
+func DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	var req DisableTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if user.Password != "" && !checkPassword(req.Password, user.Password) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Incorrect password"})
+		return
+	}
+
+	if !checkSecondFactor(ctx, user, req.Code, normalizeIfRecovery(req.Code)) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid authentication code"})
+		return
+	}
+
+	_, err = UsersCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set":   bson.M{"totpEnabled": false},
+		"$unset": bson.M{"totpSecret": "", "totpPendingSecret": "", "totpLastStep": "", "recoveryCodes": ""},
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current TOTP code.
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Code is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if !checkSecondFactor(ctx, user, req.Code, "") {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create recovery codes"})
+		return
+	}
+
+	if _, err := UsersCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"recoveryCodes": hashes}}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to save recovery codes"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"recoveryCodes": codes})
+}
+
+// normalizeIfRecovery lets the disable endpoint take either kind of code in
+// one field: anything that isn't a 6-digit TOTP code is tried as a recovery
+// code.
+func normalizeIfRecovery(code string) string {
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits && strings.Trim(code, "0123456789") == "" {
+		return ""
+	}
+	return code
+}
+
+func RegisterTOTPRoutes(r *mux.Router) {
+	r.HandleFunc("/api/login/mfa", LoginMFA).Methods("POST")
+	r.HandleFunc("/api/2fa/enroll", JWTMiddleware(EnrollTOTP)).Methods("POST")
+	r.HandleFunc("/api/2fa/confirm", JWTMiddleware(ConfirmTOTP)).Methods("POST")
+	r.HandleFunc("/api/2fa/disable", JWTMiddleware(DisableTOTP)).Methods("POST")
+	r.HandleFunc("/api/2fa/recovery-codes", JWTMiddleware(RegenerateRecoveryCodes)).Methods("POST")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	emailVerificationTTL       = 48 * time.Hour
+	verificationResendCooldown = time.Minute
+)
+
+// EmailVerification ties a hashed token to the address it was sent to, so a
+// link only verifies the email it was delivered to.
+type EmailVerification struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    string             `bson:"userId" json:"userId"`
+	Email     string             `bson:"email" json:"email"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+}
+
+// sendEmailVerification emails a verification link for address, which is
+// either the user's current email or the new one they are changing to.
+func sendEmailVerification(ctx context.Context, user User, address string) error {
+	raw, hash, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	v := EmailVerification{
+		UserID:    user.ID.Hex(),
+		Email:     address,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(emailVerificationTTL),
+	}
+	if _, err := EmailVerificationsCol.InsertOne(ctx, v); err != nil {
+		return err
+	}
+
+	_, _ = UsersCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"verificationSentAt": now}})
+
+	return mailer.Send(ctx, MailMessage{
+		To:      address,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Welcome to RizeOS!\n\n"+
+			"Please confirm your email address by opening this link:\n%s/api/verify-email?token=%s\n\n"+
+			"The link is valid for 48 hours.\n", appURL(), raw),
+	})
+}
+
+// VerifyEmail marks the address the token was issued for as verified.
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Token is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var v EmailVerification
+	err := EmailVerificationsCol.FindOneAndDelete(ctx, bson.M{
+		"tokenHash": hashToken(token),
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&v)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Verification link is invalid or has expired"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+		return
+	}
+
+	oid, _ := primitive.ObjectIDFromHex(v.UserID)
+	res, err := UsersCol.UpdateOne(ctx,
+		bson.M{"_id": oid, "email": v.Email},
+		bson.M{"$set": bson.M{"verified": true, "verifiedAt": time.Now()}},
+	)
+	if err == nil && res.MatchedCount == 0 {
+		// The link confirms an email change: the new address replaces the
+		// old one only now.
+		res, err = UsersCol.UpdateOne(ctx,
+			bson.M{"_id": oid, "pendingEmail": v.Email},
+			bson.M{
+				"$set":   bson.M{"email": v.Email, "verified": true, "verifiedAt": time.Now()},
+				"$unset": bson.M{"pendingEmail": ""},
+			},
+		)
+	}
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Email already registered"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to verify email"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Verification link is invalid or has expired"})
+		return
+	}
+
+	_, _ = EmailVerificationsCol.DeleteMany(ctx, bson.M{"userId": v.UserID, "email": v.Email})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+// ResendVerification sends a new verification link, at most once per minute.
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userId").(string)
+	if userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+		return
+	}
+
+	if user.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "This account has no email address", "code": "no_email"})
+		return
+	}
+
+	if user.Verified {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Email already verified", "code": "email_already_verified"})
+		return
+	}
+
+	// Claim the send by moving verificationSentAt, so concurrent requests
+	// cannot both get past the cooldown.
+	now := time.Now()
+	res, err := UsersCol.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "$or": bson.A{
+			bson.M{"verificationSentAt": bson.M{"$exists": false}},
+			bson.M{"verificationSentAt": bson.M{"$lte": now.Add(-verificationResendCooldown)}},
+		}},
+		bson.M{"$set": bson.M{"verificationSentAt": now}},
+	)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+		return
+	}
+	if res.ModifiedCount == 0 {
+		wait := verificationResendCooldown
+		if user.VerificationSentAt != nil {
+			if d := time.Until(user.VerificationSentAt.Add(verificationResendCooldown)); d > 0 {
+				wait = d
+			}
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Please wait before requesting another email", "code": "verification_throttled"})
+		return
+	}
+
+	if err := sendEmailVerification(ctx, user, user.Email); err != nil {
+		log.Println("resend verification:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to send verification email"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
+
+func RegisterVerificationRoutes(r *mux.Router) {
+	r.HandleFunc("/api/verify-email", VerifyEmail).Methods("GET")
+	r.HandleFunc("/api/verify-email/resend", JWTMiddleware(ResendVerification)).Methods("POST")
+}
@@ -4,11 +4,11 @@ export function getToken() {
   return localStorage.getItem('token');
 }
 
-export async function signup(email, password) {
+export async function signup(email, password, role) {
   const res = await fetch(`${API_BASE}/api/signup`, {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
-    body: JSON.stringify({ email, password }),
+    body: JSON.stringify({ email, password, role }),
   });
   const data = await res.json().catch(() => ({}));
   if (!res.ok) throw new Error(data.error || 'Signup failed');
@@ -26,16 +26,77 @@ export async function login(email, password) {
   return data;
 }
 
-export function setAuth(token, user) {
+export async function loginMFA(mfaToken, code, recoveryCode) {
+  const res = await fetch(`${API_BASE}/api/login/mfa`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ mfaToken, code, recoveryCode }),
+  });
+  const data = await res.json().catch(() => ({}));
+  if (!res.ok) throw new Error(data.error || 'Verification failed');
+  return data;
+}
+
+export async function siweNonce() {
+  const res = await fetch(`${API_BASE}/api/siwe/nonce`);
+  const data = await res.json().catch(() => ({}));
+  if (!res.ok) throw new Error(data.error || 'Failed to get nonce');
+  return data.nonce;
+}
+
+export async function siweLogin(message, signature) {
+  const token = getToken();
+  const res = await fetch(`${API_BASE}/api/siwe/verify`, {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+      ...(token && { Authorization: `Bearer ${token}` }),
+    },
+    body: JSON.stringify({ message, signature }),
+  });
+  const data = await res.json().catch(() => ({}));
+  if (!res.ok) throw new Error(data.error || 'Wallet sign-in failed');
+  return data;
+}
+
+export function setAuth(token, user, refreshToken) {
   if (token) {
     localStorage.setItem('token', token);
+    if (refreshToken) localStorage.setItem('refreshToken', refreshToken);
     if (user && user.email) localStorage.setItem('userEmail', user.email);
   } else {
     localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
     localStorage.removeItem('userEmail');
   }
 }
 
+export async function refreshSession() {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (!refreshToken) return false;
+  const res = await fetch(`${API_BASE}/api/token/refresh`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ refreshToken }),
+  });
+  const data = await res.json().catch(() => ({}));
+  if (!res.ok) {
+    setAuth(null);
+    return false;
+  }
+  setAuth(data.token, data.user, data.refreshToken);
+  return true;
+}
+
+export async function logout(all = false) {
+  const refreshToken = localStorage.getItem('refreshToken');
+  try {
+    await api('/api/logout', { method: 'POST', body: JSON.stringify({ refreshToken, all }) });
+  } finally {
+    setAuth(null);
+  }
+}
+
 export function getStoredUserEmail() {
   return localStorage.getItem('userEmail') || '';
 }
@@ -44,7 +105,7 @@ export function isAuthenticated() {
   return !!getToken();
 }
 
-export async function api(path, options = {}) {
+export async function api(path, options = {}, retried = false) {
   const token = getToken();
   const headers = {
     'Content-Type': 'application/json',
@@ -52,14 +113,18 @@ export async function api(path, options = {}) {
     ...options.headers,
   };
   const res = await fetch(`${API_BASE}${path}`, { ...options, headers });
+  if (res.status === 401 && !retried && (await refreshSession())) {
+    return api(path, options, true);
+  }
   const data = await res.json().catch(() => ({}));
   if (!res.ok) throw new Error(data.error || 'Request failed');
   return data;
 }
 
-export async function getJobs() {
-  // Public endpoint - no auth required
-  const res = await fetch(`${API_BASE}/api/jobs`, {
+export async function getJobs(params = {}) {
+  // Public endpoint - no auth required. Returns { jobs, nextCursor }.
+  const query = new URLSearchParams(params).toString();
+  const res = await fetch(`${API_BASE}/api/jobs${query ? `?${query}` : ''}`, {
     method: 'GET',
     headers: { 'Content-Type': 'application/json' },
   });
@@ -21,7 +21,8 @@ export function AuthProvider({ children }) {
   const login = async (email, password) => {
     try {
       const data = await api.login(email, password);
-      api.setAuth(data.token, data.user);
+      if (data.mfaRequired) return { success: false, mfaRequired: true, mfaToken: data.mfaToken };
+      api.setAuth(data.token, data.user, data.refreshToken);
       setToken(data.token);
       setUser(data.user ? { ...data.user, name: data.user.email?.split('@')[0] } : { id: '', email, name: email.split('@')[0] });
       return { success: true };
@@ -32,9 +33,9 @@ export function AuthProvider({ children }) {
 
   const signup = async (signupData) => {
     try {
-      await api.signup(signupData.email, signupData.password);
+      await api.signup(signupData.email, signupData.password, signupData.role);
       const data = await api.login(signupData.email, signupData.password);
-      api.setAuth(data.token, data.user);
+      api.setAuth(data.token, data.user, data.refreshToken);
       setToken(data.token);
       setUser(data.user ? { ...data.user, name: signupData.name || data.user.email?.split('@')[0] } : { id: '', email: signupData.email, name: signupData.name || signupData.email.split('@')[0] });
       return { success: true };
@@ -44,7 +45,7 @@ export function AuthProvider({ children }) {
   };
 
   const logout = () => {
-    api.setAuth(null);
+    api.logout().catch(() => {});
     setToken(null);
     setUser(null);
   };
@@ -10,6 +10,28 @@ import { useAuth } from '../contexts/AuthContext';
 
 const filters = ['All Jobs', 'Full-time', 'Contract', 'Remote', 'Crypto Pay'];
 
+const periodLabels = { hourly: '/hr', monthly: '/mo', yearly: '/yr' };
+
+// Salaries are { min, max, currency, period, equity }; older ones may only
+// have the text they were posted with.
+function formatSalary(salary) {
+  if (typeof salary === 'string') return salary;
+  if (!salary.max) return salary.text || '';
+  const fmt = (n) =>
+    salary.currency
+      ? new Intl.NumberFormat(undefined, {
+          style: 'currency',
+          currency: salary.currency,
+          maximumFractionDigits: 0,
+        }).format(n)
+      : n.toLocaleString();
+  const range =
+    salary.min && salary.min !== salary.max
+      ? `${fmt(salary.min)} – ${fmt(salary.max)}`
+      : fmt(salary.max);
+  return `${range}${periodLabels[salary.period] || ''}${salary.equity ? ' + equity' : ''}`;
+}
+
 export default function Jobs() {
   const [jobs, setJobs] = useState([]);
   const [loading, setLoading] = useState(true);
@@ -28,7 +50,7 @@ export default function Jobs() {
     let cancelled = false;
     getJobs()
       .then((data) => {
-        if (!cancelled) setJobs(Array.isArray(data) ? data : []);
+        if (!cancelled) setJobs(Array.isArray(data.jobs) ? data.jobs : []);
       })
       .catch(() => {
         if (!cancelled) setJobs([]);
@@ -236,7 +258,7 @@ export default function Jobs() {
                           {job.salary && (
                             <span className="flex items-center gap-1">
                               <DollarSign className="w-4 h-4" />
-                              {job.salary}
+                              {formatSalary(job.salary)}
                             </span>
                           )}
                           {job.skills && job.skills.length > 0 && (
@@ -7,7 +7,7 @@ import { User, Mail, Lock, ArrowRight, Loader2, Linkedin } from 'lucide-react';
 import { useAuth } from '../contexts/AuthContext';
 
 export default function Register() {
-  const [formData, setFormData] = useState({ name: '', email: '', password: '', linkedin: '' });
+  const [formData, setFormData] = useState({ name: '', email: '', password: '', linkedin: '', role: 'candidate' });
   const [isLoading, setIsLoading] = useState(false);
   const { signup } = useAuth();
   const navigate = useNavigate();
@@ -64,6 +64,13 @@ export default function Register() {
                 <Input id="password" name="password" type="password" placeholder="••••••••" value={formData.password} onChange={handleChange} className="pl-10 h-12 bg-secondary border-border" disabled={isLoading} required minLength={6} />
               </div>
             </div>
+            <div className="space-y-2">
+              <label htmlFor="role" className="text-sm font-medium text-foreground">I am</label>
+              <select id="role" name="role" value={formData.role} onChange={handleChange} className="w-full h-12 px-3 rounded-md bg-secondary border border-border text-foreground" disabled={isLoading}>
+                <option value="candidate">Looking for a job</option>
+                <option value="employer">Hiring</option>
+              </select>
+            </div>
             <div className="space-y-2">
               <label htmlFor="linkedin" className="text-sm font-medium text-foreground">LinkedIn URL (optional)</label>
               <div className="relative">
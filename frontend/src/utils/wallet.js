@@ -73,6 +73,33 @@ export async function connectWallet(preferredProvider = null) {
   throw new Error('No wallet found. Please install MetaMask or Phantom.');
 }
 
+// Sign-In with Ethereum (EIP-4361): builds the message for the nonce issued
+// by the backend and asks MetaMask to personal_sign it.
+export async function signSiweMessage(walletInfo, nonce) {
+  const { address, chainId } = walletInfo;
+  const issuedAt = new Date();
+  const expiresAt = new Date(issuedAt.getTime() + 5 * 60 * 1000);
+  const message = [
+    `${window.location.host} wants you to sign in with your Ethereum account:`,
+    address,
+    '',
+    'Sign in to RizeOS.',
+    '',
+    `URI: ${window.location.origin}`,
+    'Version: 1',
+    `Chain ID: ${parseInt(chainId, 16) || 1}`,
+    `Nonce: ${nonce}`,
+    `Issued At: ${issuedAt.toISOString()}`,
+    `Expiration Time: ${expiresAt.toISOString()}`,
+  ].join('\n');
+
+  const signature = await window.ethereum.request({
+    method: 'personal_sign',
+    params: [message, address],
+  });
+  return { message, signature };
+}
+
 // Platform fee payment (simplified – production should use smart contracts)
 export async function payPlatformFee(walletInfo, amount = '0.01') {
   const { address, provider } = walletInfo;